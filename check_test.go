@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/validate"
+	"github.com/stretchr/testify/require"
+)
+
+const testCaveatedDocument = `schema: |-
+  definition user {}
+
+  caveat on_network(allowed string, network string) {
+    network == allowed
+  }
+
+  definition document {
+    relation viewer: user | user with on_network
+    permission view = viewer
+  }
+relationships: |-
+  document:plan#viewer@user:alice
+  document:plan#viewer@user:bob[on_network:{"allowed":"office"}]
+`
+
+func TestCheckDocumentHandle(t *testing.T) {
+	handle := loadTestDocument(t, testCaveatedDocument)
+
+	tests := []struct {
+		name           string
+		subject        string
+		caveatContext  string
+		permissionship string
+		missingContext []string
+	}{
+		{"direct", "user:alice", "", "has_permission", nil},
+		{"missing", "user:carol", "", "no_permission", nil},
+		{"caveat missing context", "user:bob", "", "conditional_permission", []string{"network"}},
+		{"caveat true", "user:bob", `{"network":"office"}`, "has_permission", nil},
+		{"caveat false", "user:bob", `{"network":"home"}`, "no_permission", nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkDocumentHandle(context.Background(), handle, "document:plan", "view", tt.subject, tt.caveatContext)
+			require.Equal(t, validate.StatusSuccess, result.Status, result.Error)
+			require.Equal(t, tt.permissionship, result.Permissionship)
+			require.Equal(t, tt.missingContext, result.MissingContext)
+			require.NotEmpty(t, result.Trace)
+			require.Contains(t, result.TraceText, "view")
+			require.NotContains(t, result.TraceText, "\x1b")
+			if tt.subject == "user:bob" {
+				require.Len(t, result.Caveats, 1)
+				require.Equal(t, "on_network", result.Caveats[0].Name)
+				require.Equal(t, tt.missingContext, result.Caveats[0].MissingContext)
+			} else {
+				require.Empty(t, result.Caveats)
+			}
+		})
+	}
+}
+
+func TestCheckDocumentHandleErrors(t *testing.T) {
+	handle := loadTestDocument(t, testCaveatedDocument)
+
+	for _, result := range []*checkResult{
+		checkDocumentHandle(context.Background(), handle, "document", "view", "user:alice", ""),
+		checkDocumentHandle(context.Background(), handle, "document:plan", "view", "alice", ""),
+		checkDocumentHandle(context.Background(), handle, "document:plan", "view", "user:alice", "{"),
+		checkDocumentHandle(context.Background(), handle, "folder:plan", "view", "user:alice", ""),
+		checkDocumentHandle(context.Background(), 0, "document:plan", "view", "user:alice", ""),
+	} {
+		require.Equal(t, validate.StatusError, result.Status)
+		require.Equal(t, validate.CategoryInvalidArgument, result.Category, result.Error)
+	}
+}
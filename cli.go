@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+	"github.com/leetrout/python-spicedb-validation/pkg/validate"
+)
+
+// Exit codes of the command-line interface.
+const (
+	exitOK          = 0 // the document is valid, or the permission is granted
+	exitFailure     = 1 // the document is invalid, or the permission is denied
+	exitUsage       = 2 // the arguments are invalid
+	exitError       = 3 // the command could not be run, e.g. the fetch failed
+	exitConditional = 4 // the permission depends on missing caveat context
+)
+
+// stdinSource is the source naming standard input.
+const stdinSource = "-"
+
+const usage = `Usage: spicedb-validation <command> [flags] <arguments>
+
+Commands:
+  validate SOURCE...                                        validate documents
+  check SOURCE RESOURCE PERMISSION SUBJECT                  check a permission
+  expand SOURCE RESOURCE PERMISSION                         expand a permission
+  lookup resources SOURCE RESOURCE_TYPE PERMISSION SUBJECT  find resources
+  lookup subjects SOURCE RESOURCE PERMISSION SUBJECT_TYPE   find subjects
+  worker                                                    serve JSON-RPC on stdio
+
+A SOURCE is a file path, a URL, or - for standard input; validate also takes
+directories and glob patterns such as 'authz/**/*.yaml'. Flags go before the
+arguments; run a command with -h to list them.
+
+Exit codes: 0 valid or granted, 1 invalid or denied, 2 usage error,
+3 the command could not be run, 4 permission conditional on missing context.
+`
+
+// cli runs the command-line interface against the given streams.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+// commonFlags are the flags accepted by every command.
+type commonFlags struct {
+	output  string
+	color   string
+	timeout time.Duration
+	http    decode.HTTPOptions
+}
+
+func (c *cli) flagSet(name string, common *commonFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.StringVar(&common.output, "output", "text", "output format: text or json")
+	fs.StringVar(&common.color, "color", "auto", "color text output: auto, always or never")
+	fs.DurationVar(&common.timeout, "timeout", 0, "abort the command after this long, e.g. 30s")
+	fs.DurationVar(&common.http.Timeout, "http-timeout", decode.DefaultHTTPTimeout, "give up on each attempt at fetching a remote document after this long")
+	fs.IntVar(&common.http.Retries, "http-retries", decode.DefaultHTTPRetries, "retry fetching a remote document this many times on transient errors; negative disables")
+	fs.Int64Var(&common.http.MaxBodySize, "max-document-size", decode.DefaultMaxBodySize, "refuse remote documents larger than this many bytes")
+	fs.StringVar(&common.http.CacheDir, "cache-dir", "", "cache remote documents in this directory (default $"+decode.CacheDirEnv+")")
+	fs.DurationVar(&common.http.CacheTTL, "cache-ttl", decode.DefaultCacheTTL, "use cached remote documents this long before revalidating them; negative always revalidates")
+	fs.BoolVar(&common.http.Offline, "offline", false, "use only cached remote documents, never fetching them")
+	return fs
+}
+
+// parse parses the flags and checks the number of positional arguments,
+// reporting problems to stderr.
+func (c *cli) parse(fs *flag.FlagSet, common *commonFlags, args []string, minArgs, maxArgs int) bool {
+	if err := fs.Parse(args); err != nil {
+		return false
+	}
+
+	authErr := decode.CheckAuthEnv()
+	switch {
+	case authErr != nil:
+		fmt.Fprintf(c.stderr, "%s\n", authErr)
+	case common.output != "text" && common.output != "json":
+		fmt.Fprintf(c.stderr, "invalid -output %q: must be text or json\n", common.output)
+	case common.color != "auto" && common.color != "always" && common.color != "never":
+		fmt.Fprintf(c.stderr, "invalid -color %q: must be auto, always or never\n", common.color)
+	case fs.NArg() < minArgs || (maxArgs >= 0 && fs.NArg() > maxArgs):
+		fmt.Fprintf(c.stderr, "%s: wrong number of arguments\n\n%s", fs.Name(), usage)
+	default:
+		return true
+	}
+	return false
+}
+
+func (f commonFlags) json() bool {
+	return f.output == "json"
+}
+
+func (f commonFlags) colorMode() validate.ColorMode {
+	switch f.color {
+	case "always":
+		return validate.ColorAlways
+	case "never":
+		return validate.ColorNever
+	default:
+		return validate.ColorAuto
+	}
+}
+
+func (f commonFlags) context() (context.Context, context.CancelFunc) {
+	if f.timeout > 0 {
+		return context.WithTimeout(context.Background(), f.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// run runs the command in args and returns the exit code.
+func (c *cli) run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "validate":
+		return c.validate(args[1:])
+	case "check":
+		return c.check(args[1:])
+	case "expand":
+		return c.expand(args[1:])
+	case "lookup":
+		return c.lookup(args[1:])
+	case "worker":
+		return c.worker(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(c.stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(c.stderr, "unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+}
+
+// sourceOptions returns the options for validating the given source, reading
+// standard input if it is "-".
+func (c *cli) sourceOptions(common commonFlags, source string) (validate.Options, error) {
+	if source != stdinSource {
+		return validate.Options{Source: source, HTTP: common.http}, nil
+	}
+
+	contents, err := io.ReadAll(c.stdin)
+	if err != nil {
+		return validate.Options{}, fmt.Errorf("failed to read standard input: %w", err)
+	}
+	return validate.Options{Source: "stdin", Contents: contents, HTTP: common.http}, nil
+}
+
+func (c *cli) validate(args []string) int {
+	var common commonFlags
+	fs := c.flagSet("validate", &common)
+	failFast := fs.Bool("fail-fast", false, "stop at the first phase that fails")
+	keepGoing := fs.Bool("keep-going", false, "leave out invalid relationships and report every error")
+	workers := fs.Int("workers", 0, "validate up to this many documents at a time (default one per CPU)")
+	if !c.parse(fs, &common, args, 1, -1) {
+		return exitUsage
+	}
+
+	ctx, cancel := common.context()
+	defer cancel()
+
+	docs := make([]validate.Options, 0, fs.NArg())
+	for _, source := range fs.Args() {
+		opts, err := c.sourceOptions(common, source)
+		if err != nil {
+			return c.fail(common, err)
+		}
+		opts.FailFast = *failFast
+		opts.KeepGoing = *keepGoing
+		opts.Color = common.colorMode()
+		if !common.json() {
+			opts.Output = c.stdout
+		}
+		docs = append(docs, opts)
+	}
+
+	batch, _ := validate.ValidateBatch(ctx, docs, *workers)
+
+	code := exitOK
+	for _, source := range batch.Sources {
+		result := batch.Results[source]
+		switch {
+		case common.json():
+			c.writeJSON(result)
+		case result.Err() != nil:
+			fmt.Fprintf(c.stderr, "error: %s: %s\n", source, result.Err())
+		}
+		code = max(code, resultExitCode(result))
+	}
+	return code
+}
+
+func resultExitCode(result *validate.Result) int {
+	switch result.Status {
+	case validate.StatusSuccess:
+		return exitOK
+	case validate.StatusFailure:
+		return exitFailure
+	default:
+		return exitError
+	}
+}
+
+// load loads the document for check, expand and lookup. If it cannot be
+// loaded, the problems are reported and the exit code is returned.
+func (c *cli) load(ctx context.Context, common commonFlags, source string) (*validate.Document, int) {
+	opts, err := c.sourceOptions(common, source)
+	if err != nil {
+		return nil, c.fail(common, err)
+	}
+
+	doc, result := validate.Load(ctx, opts)
+	if doc != nil {
+		return doc, exitOK
+	}
+
+	switch {
+	case common.json():
+		c.writeJSON(&loadResult{Result: result})
+	case result.Status == validate.StatusError:
+		fmt.Fprintf(c.stderr, "error: %s: %s\n", opts.Source, result.Error)
+	default:
+		_ = validate.Render(c.stderr, result, common.colorMode())
+	}
+	return nil, resultExitCode(result)
+}
+
+func (c *cli) check(args []string) int {
+	var common commonFlags
+	fs := c.flagSet("check", &common)
+	caveatContext := fs.String("context", "", "caveat context, as a JSON object")
+	explain := fs.Bool("explain", false, "print the check trace")
+	if !c.parse(fs, &common, args, 4, 4) {
+		return exitUsage
+	}
+
+	contextMap, err := validate.ParseCaveatContext(*caveatContext)
+	if err != nil {
+		return c.fail(common, err)
+	}
+
+	ctx, cancel := common.context()
+	defer cancel()
+
+	doc, code := c.load(ctx, common, fs.Arg(0))
+	if doc == nil {
+		return code
+	}
+	defer doc.Close()
+
+	cr, err := doc.Check(ctx, fs.Arg(1), fs.Arg(2), fs.Arg(3), contextMap)
+	if err != nil {
+		return c.fail(common, err)
+	}
+
+	if common.json() {
+		c.writeJSON(&checkResult{Status: validate.StatusSuccess, CheckResult: cr})
+	} else {
+		fmt.Fprintln(c.stdout, describePermissionship(cr.Permissionship, cr.MissingContext))
+		if *explain {
+			_ = cr.RenderTrace(c.stdout, common.colorMode())
+		}
+	}
+
+	switch cr.Permissionship {
+	case "has_permission":
+		return exitOK
+	case "conditional_permission":
+		return exitConditional
+	default:
+		return exitFailure
+	}
+}
+
+func (c *cli) expand(args []string) int {
+	var common commonFlags
+	fs := c.flagSet("expand", &common)
+	depth := fs.Int("depth", 0, "levels of subject sets to expand; 0 expands fully")
+	if !c.parse(fs, &common, args, 3, 3) {
+		return exitUsage
+	}
+
+	ctx, cancel := common.context()
+	defer cancel()
+
+	doc, code := c.load(ctx, common, fs.Arg(0))
+	if doc == nil {
+		return code
+	}
+	defer doc.Close()
+
+	er, err := doc.Expand(ctx, fs.Arg(1), fs.Arg(2), *depth)
+	if err != nil {
+		return c.fail(common, err)
+	}
+
+	if common.json() {
+		c.writeJSON(&expandResult{Status: validate.StatusSuccess, ExpandResult: er})
+	} else {
+		fmt.Fprint(c.stdout, er.TreeText)
+	}
+	return exitOK
+}
+
+func (c *cli) lookup(args []string) int {
+	if len(args) == 0 || (args[0] != "resources" && args[0] != "subjects") {
+		fmt.Fprintf(c.stderr, "lookup: expected resources or subjects\n\n%s", usage)
+		return exitUsage
+	}
+	kind := args[0]
+
+	var common commonFlags
+	fs := c.flagSet("lookup "+kind, &common)
+	caveatContext := fs.String("context", "", "caveat context, as a JSON object")
+	if !c.parse(fs, &common, args[1:], 4, 4) {
+		return exitUsage
+	}
+
+	contextMap, err := validate.ParseCaveatContext(*caveatContext)
+	if err != nil {
+		return c.fail(common, err)
+	}
+
+	ctx, cancel := common.context()
+	defer cancel()
+
+	doc, code := c.load(ctx, common, fs.Arg(0))
+	if doc == nil {
+		return code
+	}
+	defer doc.Close()
+
+	var results []validate.LookupEntry
+	if kind == "resources" {
+		results, err = doc.LookupResources(ctx, fs.Arg(1), fs.Arg(2), fs.Arg(3), contextMap)
+	} else {
+		results, err = doc.LookupSubjects(ctx, fs.Arg(1), fs.Arg(2), fs.Arg(3), contextMap)
+	}
+	if err != nil {
+		return c.fail(common, err)
+	}
+
+	if common.json() {
+		c.writeJSON(newLookupResult(results, nil))
+		return exitOK
+	}
+
+	for _, entry := range results {
+		line := entry.ObjectID
+		if entry.Permissionship == "conditional_permission" {
+			line += " (" + describePermissionship(entry.Permissionship, entry.MissingContext) + ")"
+		}
+		if len(entry.ExcludedSubjects) > 0 {
+			excluded := make([]string, 0, len(entry.ExcludedSubjects))
+			for _, subject := range entry.ExcludedSubjects {
+				excluded = append(excluded, subject.ObjectID)
+			}
+			line += " (excluding " + strings.Join(excluded, ", ") + ")"
+		}
+		fmt.Fprintln(c.stdout, line)
+	}
+	return exitOK
+}
+
+// worker serves JSON-RPC requests on stdin and stdout until stdin is closed.
+// Console and log output goes to stderr so it cannot corrupt the responses.
+func (c *cli) worker(args []string) int {
+	fs := flag.NewFlagSet("worker", flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return exitUsage
+	}
+
+	stderr := &lineWriter{emit: func(line string) { fmt.Fprintln(c.stderr, line) }}
+	setOutputSinks(stderr, stderr, stderr)
+	defer resetOutputSinks()
+
+	if err := newWorker(c.stdin, c.stdout).serve(); err != nil {
+		fmt.Fprintf(c.stderr, "error: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func describePermissionship(permissionship string, missingContext []string) string {
+	if len(missingContext) == 0 {
+		return permissionship
+	}
+	return fmt.Sprintf("%s, missing context: %s", permissionship, strings.Join(missingContext, ", "))
+}
+
+// fail reports an error that kept the command from running.
+func (c *cli) fail(common commonFlags, err error) int {
+	if common.json() {
+		c.writeJSON(newErrorResult(err))
+	} else {
+		fmt.Fprintf(c.stderr, "error: %s\n", err)
+	}
+	return exitError
+}
+
+// writeJSON writes v to stdout as a single line of JSON.
+func (c *cli) writeJSON(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(newErrorResult(err))
+	}
+	fmt.Fprintf(c.stdout, "%s\n", data)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}
+	return c.run(args), stdout.String(), stderr.String()
+}
+
+func writeTestFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+func TestCLIValidate(t *testing.T) {
+	path := writeTestFile(t, testDocument)
+
+	code, stdout, _ := runCLI(t, "", "validate", "-color", "never", path)
+	require.Equal(t, exitOK, code)
+	require.Contains(t, stdout, "Success!")
+
+	failing := strings.Replace(testDocument, "assertFalse:\n    - document:plan#view@user:carol", "assertFalse:\n    - document:plan#view@user:alice", 1)
+	code, stdout, _ = runCLI(t, failing, "validate", "-output", "json", "-")
+	require.Equal(t, exitFailure, code)
+	var result map[string]any
+	require.NoError(t, json.Unmarshal([]byte(stdout), &result))
+	require.Equal(t, "failure", result["status"])
+	require.Equal(t, "stdin", result["file"])
+
+	code, stdout, _ = runCLI(t, "schema: [\n", "validate", "-color", "never", "-")
+	require.Equal(t, exitFailure, code)
+	require.Contains(t, stdout, ":1:1")
+
+	code, _, stderr := runCLI(t, "", "validate", filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Equal(t, exitError, code)
+	require.Contains(t, stderr, "no such file")
+
+	code, stdout, _ = runCLI(t, "", "validate", "-color", "never", filepath.Dir(path))
+	require.Equal(t, exitOK, code)
+	require.Equal(t, 1, strings.Count(stdout, "Success!"))
+
+	code, _, _ = runCLI(t, "", "validate", "-output", "xml", path)
+	require.Equal(t, exitUsage, code)
+
+	code, _, _ = runCLI(t, "", "validate")
+	require.Equal(t, exitUsage, code)
+
+	t.Setenv("SPICEDB_VALIDATION_HTTP_AUTH", "example.com=digest:s3cret")
+	code, _, stderr = runCLI(t, "", "validate", path)
+	require.Equal(t, exitUsage, code)
+	require.Contains(t, stderr, "entry for example.com must use bearer or basic")
+	require.NotContains(t, stderr, "s3cret")
+}
+
+func TestCLICheck(t *testing.T) {
+	path := writeTestFile(t, testCaveatedDocument)
+
+	tests := []struct {
+		subject       string
+		caveatContext string
+		code          int
+		output        string
+	}{
+		{"user:alice", "", exitOK, "has_permission\n"},
+		{"user:carol", "", exitFailure, "no_permission\n"},
+		{"user:bob", "", exitConditional, "conditional_permission, missing context: network\n"},
+		{"user:bob", `{"network":"office"}`, exitOK, "has_permission\n"},
+	}
+	for _, tt := range tests {
+		code, stdout, _ := runCLI(t, "", "check", "-context", tt.caveatContext, path, "document:plan", "view", tt.subject)
+		require.Equal(t, tt.code, code, tt.subject)
+		require.Equal(t, tt.output, stdout, tt.subject)
+	}
+
+	code, stdout, _ := runCLI(t, "", "check", "-output", "json", "-color", "always", path, "document:plan", "view", "user:alice")
+	require.Equal(t, exitOK, code)
+	require.Contains(t, stdout, `"permissionship":"has_permission"`)
+	require.Contains(t, stdout, `"traceText":"`)
+	require.NotContains(t, stdout, `\u001b`)
+
+	_, stdout, _ = runCLI(t, "", "check", "-explain", "-color", "always", path, "document:plan", "view", "user:alice")
+	require.Contains(t, stdout, "\x1b[")
+	_, stdout, _ = runCLI(t, "", "check", "-explain", "-color", "never", path, "document:plan", "view", "user:alice")
+	require.Contains(t, stdout, "user:alice")
+	require.NotContains(t, stdout, "\x1b")
+
+	code, _, stderr := runCLI(t, "", "check", path, "document", "view", "user:alice")
+	require.Equal(t, exitError, code)
+	require.Contains(t, stderr, "invalid resource")
+
+	code, _, stderr = runCLI(t, "", "check", "-color", "never", writeTestFile(t, "schema: |-\n  definition user {\n"), "document:plan", "view", "user:alice")
+	require.Equal(t, exitFailure, code)
+	require.Contains(t, stderr, "error:")
+}
+
+func TestCLIExpandAndLookup(t *testing.T) {
+	path := writeTestFile(t, testGroupDocument)
+
+	code, stdout, _ := runCLI(t, "", "expand", "-color", "never", path, "document:plan", "view")
+	require.Equal(t, exitOK, code)
+	require.Contains(t, stdout, "user:carol")
+
+	caveated := writeTestFile(t, testCaveatedDocument)
+	code, stdout, _ = runCLI(t, "", "lookup", "resources", caveated, "document", "view", "user:bob")
+	require.Equal(t, exitOK, code)
+	require.Equal(t, "plan (conditional_permission, missing context: network)\n", stdout)
+
+	code, stdout, _ = runCLI(t, "", "lookup", "subjects", "-output", "json", caveated, "document:plan", "view", "user")
+	require.Equal(t, exitOK, code)
+	require.Contains(t, stdout, `"objectId":"bob","permissionship":"conditional_permission"`)
+
+	code, _, _ = runCLI(t, "", "lookup", "things", path)
+	require.Equal(t, exitUsage, code)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+	"github.com/leetrout/python-spicedb-validation/pkg/validate"
+)
+
+// documentRegistry hands out opaque handles for loaded documents so they can
+// be referenced across the C boundary.
+type documentRegistry struct {
+	mu         sync.Mutex
+	lastHandle uint64
+	documents  map[uint64]*validate.Document
+}
+
+var documents = &documentRegistry{documents: map[uint64]*validate.Document{}}
+
+func (r *documentRegistry) add(doc *validate.Document) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastHandle++
+	r.documents[r.lastHandle] = doc
+	return r.lastHandle
+}
+
+func (r *documentRegistry) get(handle uint64) (*validate.Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	doc, ok := r.documents[handle]
+	if !ok {
+		return nil, invalidArgument("unknown document handle %d", handle)
+	}
+	return doc, nil
+}
+
+func (r *documentRegistry) remove(handle uint64) (*validate.Document, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	doc, ok := r.documents[handle]
+	if !ok {
+		return nil, invalidArgument("unknown document handle %d", handle)
+	}
+	delete(r.documents, handle)
+	return doc, nil
+}
+
+// loadResult is the outcome of loading a document into a handle.
+type loadResult struct {
+	*validate.Result
+
+	// Handle identifies the loaded document; it is zero if loading failed.
+	Handle uint64 `json:"handle"`
+}
+
+// loadBatchResult is the outcome of loading each of the documents a
+// directory or glob pattern names, keyed by source as in a
+// validate.BatchResult.
+type loadBatchResult struct {
+	// Status is StatusError if any document could not be loaded,
+	// StatusFailure if any has errors, and StatusSuccess otherwise.
+	Status  validate.Status        `json:"status"`
+	Sources []string               `json:"sources"`
+	Results map[string]*loadResult `json:"results"`
+}
+
+// checkResult is the outcome of a permission check against a loaded document.
+type checkResult struct {
+	Status   validate.Status   `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Category validate.Category `json:"category,omitempty"`
+	*validate.CheckResult
+}
+
+// expandResult is the outcome of expanding a permission in a loaded document.
+type expandResult struct {
+	Status   validate.Status   `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Category validate.Category `json:"category,omitempty"`
+	*validate.ExpandResult
+}
+
+// lookupResult is the outcome of a LookupResources or LookupSubjects call
+// against a loaded document.
+type lookupResult struct {
+	Status   validate.Status        `json:"status"`
+	Error    string                 `json:"error,omitempty"`
+	Category validate.Category      `json:"category,omitempty"`
+	Results  []validate.LookupEntry `json:"results"`
+}
+
+// loadDocumentHandle loads a document and registers it, returning its handle
+// in the result.
+func loadDocumentHandle(ctx context.Context, opts validate.Options) *loadResult {
+	doc, result := validate.Load(ctx, opts)
+	if doc == nil {
+		return &loadResult{Result: result}
+	}
+	return &loadResult{Result: result, Handle: documents.add(doc)}
+}
+
+// loadSource loads the document the options describe or, if their source
+// is a directory or glob pattern, each of the documents it names into a
+// handle of its own.
+func loadSource(ctx context.Context, opts validate.Options) any {
+	if opts.Contents != nil || !namesSeveral(opts.Source) {
+		return loadDocumentHandle(ctx, opts)
+	}
+
+	u, _ := url.Parse(opts.Source)
+	urls, err := decode.ExpandURL(u)
+	if err != nil {
+		return &loadResult{Result: validate.NewResult(opts.Source).Fail(&validate.Error{Category: validate.CategoryDecode, Err: err})}
+	}
+
+	batch := &loadBatchResult{Status: validate.StatusSuccess, Sources: []string{}, Results: make(map[string]*loadResult, len(urls))}
+	for _, u := range urls {
+		docOpts := opts
+		docOpts.Source = u.String()
+		loaded := loadDocumentHandle(ctx, docOpts)
+		batch.Sources = append(batch.Sources, docOpts.Source)
+		batch.Results[docOpts.Source] = loaded
+		switch {
+		case loaded.Status == validate.StatusError:
+			batch.Status = validate.StatusError
+		case loaded.Status == validate.StatusFailure && batch.Status == validate.StatusSuccess:
+			batch.Status = validate.StatusFailure
+		}
+	}
+	return batch
+}
+
+// namesSeveral reports whether the source is a directory or glob pattern
+// standing for several documents.
+func namesSeveral(source string) bool {
+	u, err := url.Parse(source)
+	return err == nil && decode.NamesSeveral(u)
+}
+
+// validateDocumentHandle runs the assertions and expected relations of a
+// loaded document.
+func validateDocumentHandle(ctx context.Context, handle uint64) *validate.Result {
+	doc, err := documents.get(handle)
+	if err != nil {
+		return validate.NewResult("").Fail(err)
+	}
+	return doc.Validate(ctx)
+}
+
+// checkDocumentHandle checks whether the subject has the permission on the
+// resource in a loaded document. The caveat context is an optional JSON
+// object.
+func checkDocumentHandle(ctx context.Context, handle uint64, resource, permission, subject, caveatContext string) *checkResult {
+	cr, err := withDocument(handle, caveatContext, func(doc *validate.Document, contextMap map[string]any) (*validate.CheckResult, error) {
+		return doc.Check(ctx, resource, permission, subject, contextMap)
+	})
+	if err != nil {
+		return &checkResult{Status: validate.StatusError, Error: err.Error(), Category: validate.CategoryOf(err)}
+	}
+	return &checkResult{Status: validate.StatusSuccess, CheckResult: cr}
+}
+
+// expandDocumentHandle expands the permission on the resource in a loaded
+// document, up to depth levels; zero or less expands fully.
+func expandDocumentHandle(ctx context.Context, handle uint64, resource, permission string, depth int) *expandResult {
+	er, err := withDocument(handle, "", func(doc *validate.Document, _ map[string]any) (*validate.ExpandResult, error) {
+		return doc.Expand(ctx, resource, permission, depth)
+	})
+	if err != nil {
+		return &expandResult{Status: validate.StatusError, Error: err.Error(), Category: validate.CategoryOf(err)}
+	}
+	return &expandResult{Status: validate.StatusSuccess, ExpandResult: er}
+}
+
+// lookupResourcesDocumentHandle finds the resources of the given type on
+// which the subject has the permission in a loaded document.
+func lookupResourcesDocumentHandle(ctx context.Context, handle uint64, resourceType, permission, subject, caveatContext string) *lookupResult {
+	return newLookupResult(withDocument(handle, caveatContext, func(doc *validate.Document, contextMap map[string]any) ([]validate.LookupEntry, error) {
+		return doc.LookupResources(ctx, resourceType, permission, subject, contextMap)
+	}))
+}
+
+// lookupSubjectsDocumentHandle finds the subjects of the given type that have
+// the permission on the resource in a loaded document.
+func lookupSubjectsDocumentHandle(ctx context.Context, handle uint64, resource, permission, subjectType, caveatContext string) *lookupResult {
+	return newLookupResult(withDocument(handle, caveatContext, func(doc *validate.Document, contextMap map[string]any) ([]validate.LookupEntry, error) {
+		return doc.LookupSubjects(ctx, resource, permission, subjectType, contextMap)
+	}))
+}
+
+func newLookupResult(results []validate.LookupEntry, err error) *lookupResult {
+	if err != nil {
+		return &lookupResult{Status: validate.StatusError, Error: err.Error(), Category: validate.CategoryOf(err)}
+	}
+	return &lookupResult{Status: validate.StatusSuccess, Results: results}
+}
+
+// withDocument runs fn against the loaded document with the parsed caveat
+// context.
+func withDocument[T any](handle uint64, caveatContext string, fn func(doc *validate.Document, contextMap map[string]any) (T, error)) (T, error) {
+	var zero T
+	doc, err := documents.get(handle)
+	if err != nil {
+		return zero, err
+	}
+
+	contextMap, err := validate.ParseCaveatContext(caveatContext)
+	if err != nil {
+		return zero, err
+	}
+	return fn(doc, contextMap)
+}
+
+// freeDocumentHandle unregisters and closes a loaded document.
+func freeDocumentHandle(handle uint64) error {
+	doc, err := documents.remove(handle)
+	if err != nil {
+		return err
+	}
+	doc.Close()
+	return nil
+}
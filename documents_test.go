@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/authzed/spicedb/pkg/validationfile"
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+	"github.com/leetrout/python-spicedb-validation/pkg/validate"
+	"github.com/stretchr/testify/require"
+)
+
+const testDocument = `schema: |-
+  definition user {}
+
+  definition document {
+    relation viewer: user
+    relation editor: user
+    permission view = viewer + editor
+  }
+relationships: |-
+  document:plan#viewer@user:alice
+  document:plan#editor@user:bob
+assertions:
+  assertTrue:
+    - document:plan#view@user:alice
+  assertFalse:
+    - document:plan#view@user:carol
+validation:
+  document:plan#view:
+    - "[user:alice] is <document:plan#viewer>"
+    - "[user:bob] is <document:plan#editor>"
+`
+
+func loadTestDocument(t *testing.T, contents string) uint64 {
+	t.Helper()
+	loaded := loadDocumentHandle(context.Background(), validate.Options{Source: "test.yaml", Contents: []byte(contents)})
+	require.Equal(t, validate.StatusSuccess, loaded.Status, loaded.Errors)
+	require.NotZero(t, loaded.Handle)
+	t.Cleanup(func() { _ = freeDocumentHandle(loaded.Handle) })
+	return loaded.Handle
+}
+
+func TestDocumentHandles(t *testing.T) {
+	handle := loadTestDocument(t, testDocument)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := validateDocumentHandle(context.Background(), handle)
+			require.Equal(t, validate.StatusSuccess, result.Status)
+			require.Equal(t, 2, result.RelationshipsLoaded)
+			require.Equal(t, 2, result.AssertionsRun)
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, freeDocumentHandle(handle))
+	require.Error(t, freeDocumentHandle(handle))
+	require.Equal(t, validate.StatusError, validateDocumentHandle(context.Background(), handle).Status)
+}
+
+func TestLoadDocumentHandleFailure(t *testing.T) {
+	loaded := loadDocumentHandle(context.Background(), validate.Options{Source: "bad.yaml", Contents: []byte("schema: |-\n  definition user {\n")})
+	require.Equal(t, validate.StatusFailure, loaded.Status)
+	require.Zero(t, loaded.Handle)
+	require.Len(t, loaded.Errors, 1)
+	require.Equal(t, validate.SourceParse, loaded.Errors[0].Source)
+	require.Equal(t, validate.CategoryYAMLSyntax, loaded.Category)
+}
+
+func TestErrorResultJSON(t *testing.T) {
+	data, err := json.Marshal(newErrorResult(freeDocumentHandle(0)))
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"status": "error",
+		"error": "unknown document handle 0",
+		"category": {"code": 7, "name": "invalid_argument"}
+	}`, string(data))
+
+	data, err = json.Marshal(newPanicResult("boom"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"category":{"code":9,"name":"internal_error"}`)
+}
+
+func TestLoadDocumentHandleInvalidRelationship(t *testing.T) {
+	decoder := func(ctx context.Context, out interface{}) ([]byte, error) {
+		contents, err := decode.BytesDecoder([]byte(testDocument))(ctx, out)
+		parsed := out.(*validationfile.ValidationFile)
+		parsed.Relationships.Relationships[0].Subject.Object.ObjectId = ""
+		return contents, err
+	}
+
+	loaded := loadDocumentHandle(context.Background(), validate.Options{Source: "bad.yaml", Decoder: decoder})
+	require.Equal(t, validate.StatusFailure, loaded.Status)
+	require.Zero(t, loaded.Handle)
+	require.Len(t, loaded.Errors, 1)
+	require.Equal(t, validate.SourceRelationship, loaded.Errors[0].Source)
+	require.Contains(t, loaded.Errors[0].Message, "invalid relationship")
+
+	opts := callOptions{KeepGoing: true}.validateOptions(validate.Options{Source: "bad.yaml", Decoder: decoder})
+	loaded = loadDocumentHandle(context.Background(), opts)
+	require.Equal(t, validate.StatusFailure, loaded.Status)
+	require.NotZero(t, loaded.Handle)
+	defer func() { require.NoError(t, freeDocumentHandle(loaded.Handle)) }()
+	require.Equal(t, 1, loaded.RelationshipsLoaded)
+
+	result := validateDocumentHandle(context.Background(), loaded.Handle)
+	require.Equal(t, validate.StatusFailure, result.Status)
+	require.Equal(t, validate.PhaseFailed, result.Phase(validate.PhaseRelationships))
+	require.Equal(t, validate.PhaseSkipped, result.Phase(validate.PhaseAssertions))
+	require.Equal(t, 0, result.AssertionsRun)
+	require.Equal(t, 2, result.AssertionsSkipped, "both assertions check document:plan#view, which reaches the dropped viewer")
+}
+
+func TestSourceNamingSeveralDocuments(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte(testDocument), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.yaml"), []byte("schema: |-\n  definition user {\n"), 0o600))
+	pattern := filepath.Join(dir, "*.yaml")
+
+	batch, ok := validateSource(context.Background(), validate.Options{Source: pattern}).(*validate.BatchResult)
+	require.True(t, ok)
+	require.Equal(t, validate.StatusFailure, batch.Status)
+	require.Equal(t, []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")}, batch.Sources)
+	require.Equal(t, validate.StatusSuccess, batch.Results[batch.Sources[0]].Status)
+
+	loaded, ok := loadSource(context.Background(), validate.Options{Source: dir}).(*loadBatchResult)
+	require.True(t, ok)
+	require.Equal(t, validate.StatusFailure, loaded.Status)
+	require.Equal(t, batch.Sources, loaded.Sources)
+	first, second := loaded.Results[loaded.Sources[0]], loaded.Results[loaded.Sources[1]]
+	require.NotZero(t, first.Handle)
+	defer func() { require.NoError(t, freeDocumentHandle(first.Handle)) }()
+	require.Zero(t, second.Handle)
+	require.Equal(t, validate.StatusFailure, second.Status)
+
+	sourceJSON, err := json.Marshal(dir)
+	require.NoError(t, err)
+	responses := serveRequests(t, `{"jsonrpc":"2.0","id":1,"method":"validate","params":{"source":`+string(sourceJSON)+`}}`)
+	require.Len(t, resultMap(t, responses["1"])["results"], 2)
+
+	// A single document keeps its own result.
+	result, ok := validateSource(context.Background(), validate.Options{Source: loaded.Sources[0]}).(*validate.Result)
+	require.True(t, ok)
+	require.Equal(t, validate.StatusSuccess, result.Status)
+
+	missing, ok := loadSource(context.Background(), validate.Options{Source: filepath.Join(dir, "*.yml")}).(*loadResult)
+	require.True(t, ok)
+	require.Equal(t, validate.StatusError, missing.Status)
+	require.Equal(t, validate.CategoryDecode, missing.Category)
+	require.Zero(t, missing.Handle)
+}
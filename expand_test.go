@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/validate"
+	"github.com/stretchr/testify/require"
+)
+
+const testGroupDocument = `schema: |-
+  definition user {}
+
+  definition group {
+    relation member: user | group#member
+  }
+
+  definition document {
+    relation viewer: user | group#member
+    permission view = viewer
+  }
+relationships: |-
+  document:plan#viewer@user:alice
+  document:plan#viewer@group:eng#member
+  group:eng#member@user:bob
+  group:eng#member@group:infra#member
+  group:infra#member@user:carol
+  group:infra#member@group:eng#member
+`
+
+func TestExpandDocumentHandle(t *testing.T) {
+	handle := loadTestDocument(t, testGroupDocument)
+
+	shallow := expandDocumentHandle(context.Background(), handle, "document:plan", "view", 1)
+	require.Equal(t, validate.StatusSuccess, shallow.Status, shallow.Error)
+	require.Contains(t, shallow.TreeText, "group:eng->member")
+	require.NotContains(t, shallow.TreeText, "user:bob")
+	require.NotEmpty(t, shallow.Tree)
+
+	full := expandDocumentHandle(context.Background(), handle, "document:plan", "view", 0)
+	require.Equal(t, validate.StatusSuccess, full.Status, full.Error)
+	require.Contains(t, full.TreeText, "user:alice")
+	require.Contains(t, full.TreeText, "user:bob")
+	require.Contains(t, full.TreeText, "user:carol")
+
+	require.Equal(t, validate.StatusError, expandDocumentHandle(context.Background(), handle, "document", "view", 0).Status)
+	require.Equal(t, validate.StatusError, expandDocumentHandle(context.Background(), handle, "document:plan", "unknown", 0).Status)
+}
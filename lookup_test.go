@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/validate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupResourcesDocumentHandle(t *testing.T) {
+	handle := loadTestDocument(t, testCaveatedDocument)
+
+	result := lookupResourcesDocumentHandle(context.Background(), handle, "document", "view", "user:bob", "")
+	require.Equal(t, validate.StatusSuccess, result.Status, result.Error)
+	require.Equal(t, []validate.LookupEntry{
+		{ObjectID: "plan", Permissionship: "conditional_permission", MissingContext: []string{"network"}},
+	}, result.Results)
+
+	result = lookupResourcesDocumentHandle(context.Background(), handle, "document", "view", "user:bob", `{"network":"office"}`)
+	require.Equal(t, validate.StatusSuccess, result.Status, result.Error)
+	require.Equal(t, []validate.LookupEntry{{ObjectID: "plan", Permissionship: "has_permission"}}, result.Results)
+
+	result = lookupResourcesDocumentHandle(context.Background(), handle, "document", "view", "user:carol", "")
+	require.Equal(t, validate.StatusSuccess, result.Status, result.Error)
+	require.Empty(t, result.Results)
+
+	require.Equal(t, validate.StatusError, lookupResourcesDocumentHandle(context.Background(), handle, "document", "view", "carol", "").Status)
+}
+
+func TestLookupSubjectsDocumentHandle(t *testing.T) {
+	handle := loadTestDocument(t, testCaveatedDocument)
+
+	result := lookupSubjectsDocumentHandle(context.Background(), handle, "document:plan", "view", "user", "")
+	require.Equal(t, validate.StatusSuccess, result.Status, result.Error)
+	require.Equal(t, []validate.LookupEntry{
+		{ObjectID: "alice", Permissionship: "has_permission"},
+		{ObjectID: "bob", Permissionship: "conditional_permission", MissingContext: []string{"network"}},
+	}, result.Results)
+
+	require.Equal(t, validate.StatusError, lookupSubjectsDocumentHandle(context.Background(), handle, "document", "view", "user", "").Status)
+}
@@ -1,211 +1,456 @@
 package main
 
+/*
+#include <stdlib.h>
+*/
 import "C"
 import (
+	"bytes"
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
-	"net/url"
 	"os"
-	"strings"
-
-	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
-	"github.com/authzed/spicedb/pkg/development"
-	core "github.com/authzed/spicedb/pkg/proto/core/v1"
-	devinterface "github.com/authzed/spicedb/pkg/proto/developer/v1"
-	"github.com/authzed/spicedb/pkg/spiceerrors"
-	"github.com/authzed/spicedb/pkg/tuple"
-	"github.com/authzed/spicedb/pkg/validationfile"
-	"github.com/charmbracelet/lipgloss"
+	"runtime/debug"
+	"unsafe"
+
 	"github.com/leetrout/python-spicedb-validation/pkg/console"
 	"github.com/leetrout/python-spicedb-validation/pkg/decode"
-	"github.com/leetrout/python-spicedb-validation/pkg/printers"
+	"github.com/leetrout/python-spicedb-validation/pkg/validate"
 )
 
-func main() {}
+// main runs the command-line interface when the package is built as an
+// executable; it is not called when it is built as a shared library.
+func main() {
+	os.Exit((&cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}).run(os.Args[1:]))
+}
 
 //export helloWorld
 func helloWorld() {
+	defer recoverAndLog()
+
 	log.Println("Hello World")
 }
 
+// validateURL validates the document at the given URL, printing the outcome
+// to the console. It returns 0 when the document is valid and otherwise the
+// code of the validate.Category of the failure.
+//
 //export validateURL
-func validateURL(someURLPtr *C.char) {
+func validateURL(someURLPtr *C.char) (ret C.int) {
+	defer recoverToCode(&ret, C.int(validate.CategoryInternal))
+
 	someURL := C.GoString(someURLPtr)
-	log.Printf("Should validate some url: %s", someURL)
-	err := validateCmdFunc(someURL)
+	log.Printf("Should validate some url: %s", decode.RedactedSource(someURL))
+
+	// Render into a buffer of our own and print it in one go, so that the
+	// output of concurrent calls does not interleave.
+	var out bytes.Buffer
+	err := validateCmdFunc(context.Background(), &out, someURL)
+	console.Printf("%s", out.String())
 	if err != nil {
 		log.Printf("ERROR: %s", err)
+		return C.int(validate.CategoryOf(err))
 	}
+	return 0
 }
 
-var (
-	success                = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("10")).Render("Success!")
-	errorPrefix            = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("9")).Render("error: ")
-	errorMessageStyle      = lipgloss.NewStyle().Bold(true).Width(80)
-	linePrefixStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("12"))
-	highlightedSourceStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
-	highlightedLineStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
-	codeStyle              = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
-	highlightedCodeStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("15"))
-	traceStyle             = lipgloss.NewStyle().Bold(true)
-)
+// validateURLJSON validates the document at the given URL and returns the
+// result as a JSON document. A URL naming a directory or glob pattern
+// validates each of the documents it matches and returns their results as
+// validateBatchJSON does. The caller owns the returned string and must
+// release it with freeString.
+//
+// Like every function returning JSON, it takes an optional JSON object of
+// callOptions as its last argument, to set a timeout or a cancel handle.
+//
+//export validateURLJSON
+func validateURLJSON(someURLPtr, optionsPtr *C.char) (ret *C.char) {
+	defer recoverToJSON(&ret)
 
-func validateCmdFunc(someURL string) error {
-	// Parse the URL of the validation document to import.
-	u, err := url.Parse(someURL)
-	if err != nil {
-		return err
-	}
+	someURL := C.GoString(someURLPtr)
+	return withCallContext(optionsPtr, func(ctx context.Context, opts callOptions) any {
+		return validateSource(ctx, opts.validateOptions(validate.Options{Source: someURL}))
+	})
+}
 
-	decoder, err := decode.DecoderForURL(u)
-	if err != nil {
-		return err
-	}
+// validateContentsJSON validates a document passed in memory and returns the
+// result as a JSON document. The filename may be empty; when set it identifies
+// the document in the result. The caller owns the returned string and must
+// release it with freeString.
+//
+//export validateContentsJSON
+func validateContentsJSON(contentsPtr *C.char, length C.int, filenamePtr, optionsPtr *C.char) (ret *C.char) {
+	defer recoverToJSON(&ret)
 
-	// Decode the validation document.
-	var parsed validationfile.ValidationFile
-	validateContents, err := decoder(&parsed)
-	if err != nil {
-		var errWithSource spiceerrors.ErrorWithSource
-		if errors.As(err, &errWithSource) {
-			ouputErrorWithSource(validateContents, errWithSource)
-		}
+	contents := C.GoBytes(unsafe.Pointer(contentsPtr), length)
+	filename := C.GoString(filenamePtr)
+	return withCallContext(optionsPtr, func(ctx context.Context, opts callOptions) any {
+		result, _ := validate.Validate(ctx, opts.validateOptions(validate.Options{Source: filename, Contents: contents}))
+		return result
+	})
+}
 
-		return err
-	}
+// validateBatchJSON validates the documents at the URLs listed in a JSON
+// array, up to workers at a time (zero or less runs one per CPU), and returns
+// their results keyed by URL, with a summary, as a JSON document. URLs naming
+// a directory or glob pattern stand for the documents they match. The call
+// options apply to every document, and a timeout bounds the whole batch. The
+// caller owns the returned string and must release it with freeString.
+//
+//export validateBatchJSON
+func validateBatchJSON(sourcesPtr *C.char, workers C.int, optionsPtr *C.char) (ret *C.char) {
+	defer recoverToJSON(&ret)
 
-	// Create the development context.
-	ctx := context.Background()
-	tuples := make([]*core.RelationTuple, 0, len(parsed.Relationships.Relationships))
-	for _, rel := range parsed.Relationships.Relationships {
-		tuples = append(tuples, tuple.MustFromRelationship[*v1.ObjectReference, *v1.SubjectReference, *v1.ContextualizedCaveat](rel))
+	var sources []string
+	if err := json.Unmarshal([]byte(C.GoString(sourcesPtr)), &sources); err != nil {
+		return marshalToCString(newErrorResult(invalidArgument("invalid sources: %w", err)))
 	}
-	devCtx, devErrs, err := development.NewDevContext(ctx, &devinterface.RequestContext{
-		Schema:        parsed.Schema.Schema,
-		Relationships: tuples,
+	return withCallContext(optionsPtr, func(ctx context.Context, opts callOptions) any {
+		return validateBatch(ctx, opts, sources, int(workers))
 	})
-	if err != nil {
-		return err
-	}
-	if devErrs != nil {
-		outputDeveloperErrorsWithLineOffset(validateContents, devErrs.InputErrors, 1 /* for the 'schema:' */)
-	}
+}
 
-	// Run assertions.
-	adevErrs, aerr := development.RunAllAssertions(devCtx, &parsed.Assertions)
-	if aerr != nil {
-		return aerr
-	}
-	if adevErrs != nil {
-		outputDeveloperErrors(validateContents, adevErrs)
+// loadDocumentURL loads the document at the given URL into a development
+// context that stays alive until freeDocument is called. The returned JSON
+// document carries the handle to pass to the other document functions, or a
+// zero handle and the errors if the document could not be loaded. A URL
+// naming a directory or glob pattern loads each of the documents it matches,
+// returning their results, each with its own handle, keyed by source.
+//
+//export loadDocumentURL
+func loadDocumentURL(someURLPtr, optionsPtr *C.char) (ret *C.char) {
+	defer recoverToJSON(&ret)
+
+	someURL := C.GoString(someURLPtr)
+	return withCallContext(optionsPtr, func(ctx context.Context, opts callOptions) any {
+		return loadSource(ctx, opts.validateOptions(validate.Options{Source: someURL}))
+	})
+}
+
+// loadDocumentContents is loadDocumentURL for a document passed in memory.
+//
+//export loadDocumentContents
+func loadDocumentContents(contentsPtr *C.char, length C.int, filenamePtr, optionsPtr *C.char) (ret *C.char) {
+	defer recoverToJSON(&ret)
+
+	contents := C.GoBytes(unsafe.Pointer(contentsPtr), length)
+	filename := C.GoString(filenamePtr)
+	return withCallContext(optionsPtr, func(ctx context.Context, opts callOptions) any {
+		return loadDocumentHandle(ctx, opts.validateOptions(validate.Options{Source: filename, Contents: contents}))
+	})
+}
+
+// validateDocumentJSON runs the assertions and expected relations of a loaded
+// document and returns the result as a JSON document.
+//
+//export validateDocumentJSON
+func validateDocumentJSON(handle C.ulonglong, optionsPtr *C.char) (ret *C.char) {
+	defer recoverToJSON(&ret)
+
+	return withCallContext(optionsPtr, func(ctx context.Context, _ callOptions) any {
+		return validateDocumentHandle(ctx, uint64(handle))
+	})
+}
+
+// checkPermission checks whether the subject has the permission on the
+// resource in a loaded document and returns the permissionship and check
+// trace as a JSON document. The caveat context is an optional JSON object.
+//
+//export checkPermission
+func checkPermission(handle C.ulonglong, resourcePtr, permissionPtr, subjectPtr, caveatContextPtr, optionsPtr *C.char) (ret *C.char) {
+	defer recoverToJSON(&ret)
+
+	return withCallContext(optionsPtr, func(ctx context.Context, _ callOptions) any {
+		return checkDocumentHandle(
+			ctx,
+			uint64(handle),
+			C.GoString(resourcePtr),
+			C.GoString(permissionPtr),
+			C.GoString(subjectPtr),
+			C.GoString(caveatContextPtr),
+		)
+	})
+}
+
+// expandPermission expands the permission on the resource in a loaded
+// document and returns the expansion tree as a JSON document. Subject sets are
+// expanded up to depth levels; zero or less expands fully.
+//
+//export expandPermission
+func expandPermission(handle C.ulonglong, resourcePtr, permissionPtr *C.char, depth C.int, optionsPtr *C.char) (ret *C.char) {
+	defer recoverToJSON(&ret)
+
+	return withCallContext(optionsPtr, func(ctx context.Context, _ callOptions) any {
+		return expandDocumentHandle(
+			ctx,
+			uint64(handle),
+			C.GoString(resourcePtr),
+			C.GoString(permissionPtr),
+			int(depth),
+		)
+	})
+}
+
+// lookupResources finds the resources of the given type on which the subject
+// has the permission in a loaded document and returns them as a JSON
+// document, including whether each result is conditional on a caveat.
+//
+//export lookupResources
+func lookupResources(handle C.ulonglong, resourceTypePtr, permissionPtr, subjectPtr, caveatContextPtr, optionsPtr *C.char) (ret *C.char) {
+	defer recoverToJSON(&ret)
+
+	return withCallContext(optionsPtr, func(ctx context.Context, _ callOptions) any {
+		return lookupResourcesDocumentHandle(
+			ctx,
+			uint64(handle),
+			C.GoString(resourceTypePtr),
+			C.GoString(permissionPtr),
+			C.GoString(subjectPtr),
+			C.GoString(caveatContextPtr),
+		)
+	})
+}
+
+// lookupSubjects finds the subjects of the given type that have the
+// permission on the resource in a loaded document and returns them as a JSON
+// document, including whether each result is conditional on a caveat.
+//
+//export lookupSubjects
+func lookupSubjects(handle C.ulonglong, resourcePtr, permissionPtr, subjectTypePtr, caveatContextPtr, optionsPtr *C.char) (ret *C.char) {
+	defer recoverToJSON(&ret)
+
+	return withCallContext(optionsPtr, func(ctx context.Context, _ callOptions) any {
+		return lookupSubjectsDocumentHandle(
+			ctx,
+			uint64(handle),
+			C.GoString(resourcePtr),
+			C.GoString(permissionPtr),
+			C.GoString(subjectTypePtr),
+			C.GoString(caveatContextPtr),
+		)
+	})
+}
+
+// freeDocument disposes of a loaded document. It returns 0 on success and -1
+// if the handle is unknown.
+//
+//export freeDocument
+func freeDocument(handle C.ulonglong) (ret C.int) {
+	defer recoverToCode(&ret, -1)
+
+	if err := freeDocumentHandle(uint64(handle)); err != nil {
+		log.Printf("ERROR: %s", err)
+		return -1
 	}
+	return 0
+}
 
-	// Run expected relations.
-	_, erDevErrs, rerr := development.RunValidation(devCtx, &parsed.ExpectedRelations)
-	if rerr != nil {
-		return rerr
+// newCancelHandle returns a handle that calls can opt into through their
+// options, so that they can be aborted with cancelHandle.
+//
+//export newCancelHandle
+func newCancelHandle() (ret C.ulonglong) {
+	defer recoverAndLog()
+
+	return C.ulonglong(cancelScopes.add())
+}
+
+// cancelHandle aborts every in-flight call using the handle, including
+// fetching remote documents and running checks. It returns 0 on success and
+// -1 if the handle is unknown.
+//
+//export cancelHandle
+func cancelHandle(handle C.ulonglong) (ret C.int) {
+	defer recoverToCode(&ret, -1)
+
+	if err := cancelScopes.cancel(uint64(handle)); err != nil {
+		log.Printf("ERROR: %s", err)
+		return -1
 	}
-	if erDevErrs != nil {
-		outputDeveloperErrors(validateContents, erDevErrs)
+	return 0
+}
+
+// freeCancelHandle releases a handle from newCancelHandle, canceling any
+// calls still using it. It returns 0 on success and -1 if the handle is
+// unknown.
+//
+//export freeCancelHandle
+func freeCancelHandle(handle C.ulonglong) (ret C.int) {
+	defer recoverToCode(&ret, -1)
+
+	if err := cancelScopes.remove(uint64(handle)); err != nil {
+		log.Printf("ERROR: %s", err)
+		return -1
 	}
+	return 0
+}
+
+// setOutputCallback routes every console and log line to the given callback,
+// a `void (*)(int stream, const char* line)`. The stream is 0 for regular
+// output, 1 for error output and 2 for log messages. The line is only valid
+// for the duration of the call. Passing NULL restores the default output.
+// It returns once calls to the previous callback have returned, so that it
+// can be freed; the callback must not itself set or reset the callback.
+//
+//export setOutputCallback
+func setOutputCallback(cb unsafe.Pointer) {
+	defer recoverAndLog()
 
-	fmt.Print(success)
-	console.Printf(" - %d relationships loaded, %d assertions run, %d expected relations validated\n",
-		len(tuples),
-		len(parsed.Assertions.AssertTrue)+len(parsed.Assertions.AssertFalse),
-		len(parsed.ExpectedRelations.ValidationMap),
+	if cb == nil {
+		resetOutputSinks()
+		return
+	}
+	setOutputSinks(
+		callbackWriter(cb, streamStdout),
+		callbackWriter(cb, streamStderr),
+		callbackWriter(cb, streamLog),
 	)
-	return nil
 }
 
-func ouputErrorWithSource(validateContents []byte, errWithSource spiceerrors.ErrorWithSource) {
-	lines := strings.Split(string(validateContents), "\n")
+// resetOutputCallback restores the default stdout, stderr and log output.
+//
+//export resetOutputCallback
+func resetOutputCallback() {
+	defer recoverAndLog()
 
-	console.Printf("%s%s\n", errorPrefix, errorMessageStyle.Render(errWithSource.Error()))
-	errorLineNumber := int(errWithSource.LineNumber) - 1 // errWithSource.LineNumber is 1-indexed
-	for i := errorLineNumber - 3; i < errorLineNumber+3; i++ {
-		if i == errorLineNumber {
-			renderLine(lines, i, errWithSource.SourceCodeString, errorLineNumber)
-		} else {
-			renderLine(lines, i, "", errorLineNumber)
-		}
+	resetOutputSinks()
+}
+
+// freeString releases a string returned by one of the exported functions.
+//
+//export freeString
+func freeString(ptr *C.char) {
+	defer recoverAndLog()
+
+	C.free(unsafe.Pointer(ptr))
+}
+
+// errorResult is returned in place of an exported function's usual result
+// when the call cannot be made at all, or when it panics, so that the panic
+// does not abort the host process.
+type errorResult struct {
+	Status   validate.Status   `json:"status"`
+	Error    string            `json:"error"`
+	Category validate.Category `json:"category"`
+	Stack    string            `json:"stack,omitempty"`
+}
+
+func newErrorResult(err error) *errorResult {
+	return &errorResult{Status: validate.StatusError, Error: err.Error(), Category: validate.CategoryOf(err)}
+}
+
+func newPanicResult(recovered any) *errorResult {
+	return &errorResult{
+		Status:   validate.StatusError,
+		Error:    fmt.Sprintf("panic: %v", recovered),
+		Category: validate.CategoryInternal,
+		Stack:    string(debug.Stack()),
 	}
-	os.Exit(1)
 }
 
-func outputDeveloperErrors(validateContents []byte, devErrors []*devinterface.DeveloperError) {
-	outputDeveloperErrorsWithLineOffset(validateContents, devErrors, 0)
+// invalidArgument returns an error for a call made with arguments that do
+// not name anything, such as an unknown handle.
+func invalidArgument(format string, a ...any) error {
+	return &validate.Error{Category: validate.CategoryInvalidArgument, Err: fmt.Errorf(format, a...)}
 }
 
-func outputDeveloperErrorsWithLineOffset(validateContents []byte, devErrors []*devinterface.DeveloperError, lineOffset int) {
-	lines := strings.Split(string(validateContents), "\n")
+// recoverToJSON must be deferred by exported functions returning JSON. It
+// replaces the result with a panicResult if the function panics.
+func recoverToJSON(ret **C.char) {
+	if r := recover(); r != nil {
+		*ret = marshalToCString(newPanicResult(r))
+	}
+}
 
-	for _, devErr := range devErrors {
-		outputDeveloperError(devErr, lines, lineOffset)
+// recoverToCode must be deferred by exported functions returning a status
+// code. It logs the panic and replaces the result with the given code.
+func recoverToCode(ret *C.int, code C.int) {
+	if r := recover(); r != nil {
+		panicked := newPanicResult(r)
+		log.Printf("ERROR: %s\n%s", panicked.Error, panicked.Stack)
+		*ret = code
 	}
+}
 
-	os.Exit(1)
+// recoverAndLog must be deferred by exported functions without a result. It
+// logs the panic.
+func recoverAndLog() {
+	if r := recover(); r != nil {
+		panicked := newPanicResult(r)
+		log.Printf("ERROR: %s\n%s", panicked.Error, panicked.Stack)
+	}
 }
 
-func outputDeveloperError(devError *devinterface.DeveloperError, lines []string, lineOffset int) {
-	console.Printf("%s %s\n", errorPrefix, errorMessageStyle.Render(devError.Message))
-	errorLineNumber := int(devError.Line) - 1 + lineOffset // devError.Line is 1-indexed
-	for i := errorLineNumber - 3; i < errorLineNumber+3; i++ {
-		if i == errorLineNumber {
-			renderLine(lines, i, devError.Context, errorLineNumber)
-		} else {
-			renderLine(lines, i, "", errorLineNumber)
-		}
+// withCallContext runs fn under the context described by the call options
+// and returns its result as a JSON document.
+func withCallContext(optionsPtr *C.char, fn func(ctx context.Context, opts callOptions) any) *C.char {
+	opts, err := parseCallOptions(C.GoString(optionsPtr))
+	if err != nil {
+		return marshalToCString(newErrorResult(err))
 	}
 
-	if devError.CheckResolvedDebugInformation != nil && devError.CheckResolvedDebugInformation.Check != nil {
-		console.Printf("\n  %s\n", traceStyle.Render("Explanation:"))
-		tp := printers.NewTreePrinter()
-		printers.DisplayCheckTrace(devError.CheckResolvedDebugInformation.Check, tp, true)
-		tp.PrintIndented()
+	ctx, cancel, err := opts.context()
+	if err != nil {
+		return marshalToCString(newErrorResult(err))
 	}
+	defer cancel()
 
-	console.Printf("\n\n")
+	return marshalToCString(fn(ctx, opts))
 }
 
-func renderLine(lines []string, index int, highlight string, highlightLineIndex int) {
-	if index < 0 || index >= len(lines) {
-		return
+func marshalToCString(v any) *C.char {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(newErrorResult(err))
 	}
+	return C.CString(string(data))
+}
 
-	lineNumberLength := len(fmt.Sprintf("%d", len(lines)))
-	lineContents := lines[index]
-	lineDelimiter := "|"
-	highlightIndex := strings.Index(lineContents, highlight)
-	lineNumberStr := fmt.Sprintf("%d", index+1)
-	spacer := strings.Repeat(" ", lineNumberLength)
-
-	lineNumberStyle := linePrefixStyle
-	lineContentsStyle := codeStyle
-	if index == highlightLineIndex {
-		lineNumberStyle = highlightedLineStyle
-		lineContentsStyle = highlightedCodeStyle
-		lineDelimiter = ">"
-	}
-
-	if highlightIndex < 0 || len(highlight) == 0 {
-		console.Printf(" %s %s %s\n", lineNumberStyle.Render(lineNumberStr), lineDelimiter, lineContentsStyle.Render(lineContents))
-	} else {
-		console.Printf(" %s %s %s%s%s\n",
-			lineNumberStyle.Render(lineNumberStr),
-			lineDelimiter,
-			lineContentsStyle.Render(lineContents[0:highlightIndex]),
-			highlightedSourceStyle.Render(highlight),
-			lineContentsStyle.Render(lineContents[highlightIndex+len(highlight):]),
-		)
-		console.Printf(" %s %s %s%s%s\n",
-			lineNumberStyle.Render(spacer),
-			lineDelimiter,
-			strings.Repeat(" ", highlightIndex),
-			highlightedSourceStyle.Render("^"),
-			highlightedSourceStyle.Render(strings.Repeat("~", len(highlight)-1)),
-		)
+// validateBatch validates the documents at the given URLs under the same
+// call options.
+func validateBatch(ctx context.Context, opts callOptions, sources []string, workers int) *validate.BatchResult {
+	docs := make([]validate.Options, len(sources))
+	for i, source := range sources {
+		docs[i] = opts.validateOptions(validate.Options{Source: source})
+	}
+	batch, _ := validate.ValidateBatch(ctx, docs, workers)
+	return batch
+}
+
+// validateSource validates the document the options describe or, if their
+// source is a directory or glob pattern, each of the documents it names,
+// returning their results as a batch.
+func validateSource(ctx context.Context, opts validate.Options) any {
+	if opts.Contents == nil && namesSeveral(opts.Source) {
+		batch, _ := validate.ValidateBatch(ctx, []validate.Options{opts}, 0)
+		return batch
+	}
+	result, _ := validate.Validate(ctx, opts)
+	return result
+}
+
+// validateCmdFunc validates the document at the given URL, or each of the
+// documents it names if it is a directory or a glob pattern, and renders the
+// outcome to w.
+func validateCmdFunc(ctx context.Context, w io.Writer, someURL string) error {
+	batch, err := validate.ValidateBatch(ctx, []validate.Options{{Source: someURL, Output: w}}, 0)
+	if err != nil {
+		return err
+	}
+	for _, source := range batch.Sources {
+		if err := batch.Results[source].Err(); err != nil {
+			return err
+		}
 	}
+	for _, source := range batch.Sources {
+		if result := batch.Results[source]; result.Status == validate.StatusFailure {
+			return &validate.Error{
+				Category: result.Category,
+				Err:      fmt.Errorf("validation failed with %d error(s)", batch.Summary.Errors),
+			}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+	"github.com/leetrout/python-spicedb-validation/pkg/validate"
+)
+
+// callOptions are the per-call options accepted as a JSON object by the
+// exported functions.
+type callOptions struct {
+	// TimeoutMs bounds the call, including fetching the document; zero means
+	// no timeout.
+	TimeoutMs int64 `json:"timeoutMs,omitempty"`
+
+	// CancelHandle ties the call to a handle from newCancelHandle so it can be
+	// aborted from another thread with cancelHandle.
+	CancelHandle uint64 `json:"cancelHandle,omitempty"`
+
+	// FailFast stops validation at the first phase that fails.
+	FailFast bool `json:"failFast,omitempty"`
+
+	// KeepGoing leaves out invalid relationships to report as many errors
+	// as possible; see validate.Options.KeepGoing.
+	KeepGoing bool `json:"keepGoing,omitempty"`
+
+	// HTTP configures fetching documents over HTTP.
+	HTTP httpOptions `json:"http,omitempty"`
+}
+
+// httpOptions configure fetching documents over HTTP; zero values take the
+// defaults of decode.HTTPOptions.
+type httpOptions struct {
+	TimeoutMs      int64 `json:"timeoutMs,omitempty"`
+	MaxBodySize    int64 `json:"maxBodySize,omitempty"`
+	Retries        int   `json:"retries,omitempty"`
+	RetryBackoffMs int64 `json:"retryBackoffMs,omitempty"`
+	MaxRedirects   int   `json:"maxRedirects,omitempty"`
+
+	// Auth holds credentials by host; see decode.HTTPAuth. Naming
+	// environment variables with tokenEnv and passwordEnv keeps secrets out
+	// of the options.
+	Auth []httpAuth `json:"auth,omitempty"`
+
+	// CacheDir, CacheTTLMs and Offline configure caching fetched documents
+	// on disk; see decode.HTTPOptions.
+	CacheDir   string `json:"cacheDir,omitempty"`
+	CacheTTLMs int64  `json:"cacheTtlMs,omitempty"`
+	Offline    bool   `json:"offline,omitempty"`
+}
+
+type httpAuth struct {
+	Host        string `json:"host"`
+	Token       string `json:"token,omitempty"`
+	TokenEnv    string `json:"tokenEnv,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	PasswordEnv string `json:"passwordEnv,omitempty"`
+}
+
+func (o httpOptions) decodeOptions() decode.HTTPOptions {
+	opts := decode.HTTPOptions{
+		Timeout:      time.Duration(o.TimeoutMs) * time.Millisecond,
+		MaxBodySize:  o.MaxBodySize,
+		Retries:      o.Retries,
+		RetryBackoff: time.Duration(o.RetryBackoffMs) * time.Millisecond,
+		MaxRedirects: o.MaxRedirects,
+		CacheDir:     o.CacheDir,
+		CacheTTL:     time.Duration(o.CacheTTLMs) * time.Millisecond,
+		Offline:      o.Offline,
+	}
+	for _, auth := range o.Auth {
+		opts.Auth = append(opts.Auth, decode.HTTPAuth(auth))
+	}
+	return opts
+}
+
+// parseCallOptions parses an optional JSON object of call options.
+func parseCallOptions(options string) (callOptions, error) {
+	var parsed callOptions
+	if strings.TrimSpace(options) == "" {
+		return parsed, nil
+	}
+
+	if err := json.Unmarshal([]byte(options), &parsed); err != nil {
+		return parsed, invalidArgument("invalid options: %w", err)
+	}
+	return parsed, nil
+}
+
+// context returns the context to run the call under.
+func (o callOptions) context() (context.Context, context.CancelFunc, error) {
+	ctx := context.Background()
+	if o.CancelHandle != 0 {
+		var err error
+		ctx, err = cancelScopes.get(o.CancelHandle)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if o.TimeoutMs > 0 {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(o.TimeoutMs)*time.Millisecond)
+		return ctx, cancel, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, cancel, nil
+}
+
+// options returns the call options; params structs embedding callOptions
+// satisfy rpcParams through it.
+func (o callOptions) options() callOptions {
+	return o
+}
+
+// validateOptions applies the call options to the options of a validation.
+func (o callOptions) validateOptions(opts validate.Options) validate.Options {
+	opts.FailFast = o.FailFast
+	opts.KeepGoing = o.KeepGoing
+	opts.HTTP = o.HTTP.decodeOptions()
+	return opts
+}
+
+// cancelScopeRegistry hands out opaque handles for cancelable contexts, which
+// calls opt into through their options.
+type cancelScopeRegistry struct {
+	mu         sync.Mutex
+	lastHandle uint64
+	scopes     map[uint64]cancelScope
+}
+
+type cancelScope struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var cancelScopes = &cancelScopeRegistry{scopes: map[uint64]cancelScope{}}
+
+func (r *cancelScopeRegistry) add() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	r.lastHandle++
+	r.scopes[r.lastHandle] = cancelScope{ctx: ctx, cancel: cancel}
+	return r.lastHandle
+}
+
+func (r *cancelScopeRegistry) get(handle uint64) (context.Context, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	scope, ok := r.scopes[handle]
+	if !ok {
+		return nil, invalidArgument("unknown cancel handle %d", handle)
+	}
+	return scope.ctx, nil
+}
+
+// cancel aborts every call running under the handle. The handle stays
+// registered, so later calls using it fail immediately.
+func (r *cancelScopeRegistry) cancel(handle uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	scope, ok := r.scopes[handle]
+	if !ok {
+		return invalidArgument("unknown cancel handle %d", handle)
+	}
+	scope.cancel()
+	return nil
+}
+
+func (r *cancelScopeRegistry) remove(handle uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	scope, ok := r.scopes[handle]
+	if !ok {
+		return invalidArgument("unknown cancel handle %d", handle)
+	}
+	scope.cancel()
+	delete(r.scopes, handle)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+	"github.com/leetrout/python-spicedb-validation/pkg/validate"
+	"github.com/stretchr/testify/require"
+)
+
+func callContextFromOptions(options string) (context.Context, context.CancelFunc, error) {
+	parsed, err := parseCallOptions(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parsed.context()
+}
+
+func TestCallContextFromOptions(t *testing.T) {
+	ctx, cancel, err := callContextFromOptions("")
+	require.NoError(t, err)
+	defer cancel()
+	_, hasDeadline := ctx.Deadline()
+	require.False(t, hasDeadline)
+
+	ctx, cancel, err = callContextFromOptions(`{"timeoutMs": 1000}`)
+	require.NoError(t, err)
+	defer cancel()
+	_, hasDeadline = ctx.Deadline()
+	require.True(t, hasDeadline)
+
+	_, _, err = callContextFromOptions(`{"timeoutMs": "soon"}`)
+	require.Error(t, err)
+
+	_, _, err = callContextFromOptions(`{"cancelHandle": 12345}`)
+	require.Error(t, err)
+}
+
+func TestValidateOptionsHTTP(t *testing.T) {
+	parsed, err := parseCallOptions(`{"http": {"timeoutMs": 500, "maxBodySize": 1024, "retries": -1, "retryBackoffMs": 10, "maxRedirects": 3}}`)
+	require.NoError(t, err)
+	require.Equal(t, decode.HTTPOptions{
+		Timeout:      500 * time.Millisecond,
+		MaxBodySize:  1024,
+		Retries:      -1,
+		RetryBackoff: 10 * time.Millisecond,
+		MaxRedirects: 3,
+	}, parsed.validateOptions(validate.Options{}).HTTP)
+}
+
+func TestValidateOptionsHTTPAuth(t *testing.T) {
+	parsed, err := parseCallOptions(`{"http": {"auth": [{"host": "raw.githubusercontent.com", "tokenEnv": "GITHUB_TOKEN"}, {"host": "*.example.com", "username": "ci", "passwordEnv": "CI_PASSWORD"}]}}`)
+	require.NoError(t, err)
+	require.Equal(t, []decode.HTTPAuth{
+		{Host: "raw.githubusercontent.com", TokenEnv: "GITHUB_TOKEN"},
+		{Host: "*.example.com", Username: "ci", PasswordEnv: "CI_PASSWORD"},
+	}, parsed.validateOptions(validate.Options{}).HTTP.Auth)
+}
+
+func TestValidateOptionsHTTPCache(t *testing.T) {
+	parsed, err := parseCallOptions(`{"http": {"cacheDir": "/tmp/documents", "cacheTtlMs": 60000, "offline": true}}`)
+	require.NoError(t, err)
+	opts := parsed.validateOptions(validate.Options{}).HTTP
+	require.Equal(t, "/tmp/documents", opts.CacheDir)
+	require.Equal(t, time.Minute, opts.CacheTTL)
+	require.True(t, opts.Offline)
+}
+
+func TestCancelHandle(t *testing.T) {
+	handle := loadTestDocument(t, testCaveatedDocument)
+
+	cancelHandle := cancelScopes.add()
+	ctx, cancel, err := callOptions{CancelHandle: cancelHandle}.context()
+	require.NoError(t, err)
+	defer cancel()
+
+	result := checkDocumentHandle(ctx, handle, "document:plan", "view", "user:alice", "")
+	require.Equal(t, validate.StatusSuccess, result.Status, result.Error)
+
+	require.NoError(t, cancelScopes.cancel(cancelHandle))
+	require.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	result = checkDocumentHandle(ctx, handle, "document:plan", "view", "user:alice", "")
+	require.Equal(t, validate.StatusError, result.Status)
+	require.Equal(t, validate.CategoryCanceled, result.Category)
+
+	lookup := lookupSubjectsDocumentHandle(ctx, handle, "document:plan", "view", "user", "")
+	require.Equal(t, validate.StatusError, lookup.Status)
+
+	// The document itself is unaffected by the canceled call.
+	result = checkDocumentHandle(context.Background(), handle, "document:plan", "view", "user:alice", "")
+	require.Equal(t, validate.StatusSuccess, result.Status, result.Error)
+
+	require.NoError(t, cancelScopes.remove(cancelHandle))
+	require.Error(t, cancelScopes.cancel(cancelHandle))
+}
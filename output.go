@@ -0,0 +1,155 @@
+package main
+
+/*
+#include <stdlib.h>
+
+typedef void (*output_callback)(int stream, const char* line);
+
+static void call_output_callback(void* cb, int stream, const char* line) {
+	((output_callback)cb)(stream, line);
+}
+*/
+import "C"
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/console"
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Stream tags passed to the output callback with each line.
+const (
+	streamStdout = 0 // console.Printf
+	streamStderr = 1 // console.Errorf
+	streamLog    = 2 // log and zerolog output
+)
+
+// outputSinks are the writers console, log and zerolog output is routed to.
+type outputSinks struct {
+	stdout, stderr, logs *lineWriter
+}
+
+var (
+	defaultPrintf = console.Printf
+	defaultErrorf = console.Errorf
+
+	// sinksMu guards currentSinks. Writers hold it for reading until they
+	// are done writing, so a swap waits for them: once it returns, nothing
+	// writes to the previous sinks, whose callback the caller may free.
+	sinksMu      sync.RWMutex
+	currentSinks *outputSinks
+)
+
+// The console functions and loggers are replaced once, here, with ones that
+// look up the current sinks on every call. Swapping the sinks later then
+// never reassigns a global that another goroutine may be calling.
+func init() {
+	console.Printf = func(format string, a ...any) {
+		sinksMu.RLock()
+		defer sinksMu.RUnlock()
+		if currentSinks != nil {
+			fmt.Fprintf(currentSinks.stdout, format, a...)
+			return
+		}
+		defaultPrintf(format, a...)
+	}
+	console.Errorf = func(format string, a ...any) {
+		sinksMu.RLock()
+		defer sinksMu.RUnlock()
+		if currentSinks != nil {
+			fmt.Fprintf(currentSinks.stderr, format, a...)
+			return
+		}
+		defaultErrorf(format, a...)
+	}
+
+	var logs io.Writer = logWriter{}
+	log.SetOutput(logs)
+	zlog.Logger = zerolog.New(logs).With().Timestamp().Logger()
+}
+
+// logWriter writes to the current log sink, or to stderr when there is none.
+type logWriter struct{}
+
+func (logWriter) Write(p []byte) (int, error) {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	if currentSinks != nil {
+		return currentSinks.logs.Write(p)
+	}
+	return os.Stderr.Write(p)
+}
+
+// lineWriter buffers writes and hands each complete line, without its
+// trailing newline, to emit.
+type lineWriter struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	emit func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		idx := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+		line := w.buf.Next(idx + 1)
+		w.emit(string(line[:idx]))
+	}
+}
+
+// Flush emits any buffered partial line.
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() > 0 {
+		w.emit(w.buf.String())
+		w.buf.Reset()
+	}
+}
+
+func callbackWriter(cb unsafe.Pointer, stream int) *lineWriter {
+	return &lineWriter{emit: func(line string) {
+		cLine := C.CString(line)
+		defer C.free(unsafe.Pointer(cLine))
+		C.call_output_callback(cb, C.int(stream), cLine)
+	}}
+}
+
+// setOutputSinks routes console, log and zerolog output to the given writers.
+func setOutputSinks(stdout, stderr, logs *lineWriter) {
+	swapOutputSinks(&outputSinks{stdout: stdout, stderr: stderr, logs: logs})
+}
+
+// resetOutputSinks restores the default console, log and zerolog output.
+func resetOutputSinks() {
+	swapOutputSinks(nil)
+}
+
+// swapOutputSinks replaces the current sinks, flushing the previous ones.
+// It returns once no write to the previous sinks is in flight.
+func swapOutputSinks(sinks *outputSinks) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+
+	previous := currentSinks
+	currentSinks = sinks
+	if previous != nil {
+		previous.stdout.Flush()
+		previous.stderr.Flush()
+		previous.logs.Flush()
+	}
+}
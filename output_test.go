@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/console"
+	"github.com/stretchr/testify/require"
+)
+
+func collectingWriter(lines *[]string) *lineWriter {
+	return &lineWriter{emit: func(line string) { *lines = append(*lines, line) }}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := collectingWriter(&lines)
+
+	_, err := w.Write([]byte("first "))
+	require.NoError(t, err)
+	require.Empty(t, lines)
+
+	_, err = w.Write([]byte("line\nsecond line\nthird"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"first line", "second line"}, lines)
+
+	w.Flush()
+	require.Equal(t, []string{"first line", "second line", "third"}, lines)
+}
+
+func TestOutputSinks(t *testing.T) {
+	var stdout, stderr, logs []string
+	setOutputSinks(collectingWriter(&stdout), collectingWriter(&stderr), collectingWriter(&logs))
+	t.Cleanup(resetOutputSinks)
+
+	console.Printf("hello %s", "world")
+	console.Errorf("oops\n")
+	log.Printf("logged")
+
+	require.Empty(t, stdout)
+	require.Equal(t, []string{"oops"}, stderr)
+	require.Len(t, logs, 1)
+	require.Contains(t, logs[0], "logged")
+
+	resetOutputSinks()
+	require.Equal(t, []string{"hello world"}, stdout)
+}
+
+func TestOutputSinksConcurrentSwap(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	collect := func() *lineWriter {
+		return &lineWriter{emit: func(line string) {
+			mu.Lock()
+			defer mu.Unlock()
+			lines = append(lines, line)
+		}}
+	}
+	t.Cleanup(resetOutputSinks)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			setOutputSinks(collect(), collect(), collect())
+		}()
+		go func() {
+			defer wg.Done()
+			console.Printf("line\n")
+			log.Printf("logged")
+		}()
+	}
+	wg.Wait()
+	setOutputSinks(collect(), collect(), collect())
+	console.Printf("last\n")
+	resetOutputSinks()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, "last", lines[len(lines)-1])
+}
+
+func TestOutputSinksSwapWaitsForWriters(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	blocking := &lineWriter{emit: func(string) {
+		close(entered)
+		<-release
+	}}
+	setOutputSinks(blocking, collectingWriter(new([]string)), collectingWriter(new([]string)))
+	t.Cleanup(resetOutputSinks)
+
+	go console.Printf("line\n")
+	<-entered
+
+	swapped := make(chan struct{})
+	go func() {
+		resetOutputSinks()
+		close(swapped)
+	}()
+	select {
+	case <-swapped:
+		t.Fatal("swapped the sinks while a write to them was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-swapped
+}
@@ -0,0 +1,222 @@
+package decode
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// AuthEnv is the environment variable holding credentials for remote
+// documents, as a list of entries separated by commas or whitespace, each
+// either HOST=bearer:TOKEN or HOST=basic:USERNAME:PASSWORD. HOST is as in
+// HTTPAuth.Host.
+const AuthEnv = "SPICEDB_VALIDATION_HTTP_AUTH"
+
+// HTTPAuth holds the credentials sent when fetching from a host. Credentials
+// are only sent over https, or to loopback addresses, and are sent afresh to
+// the host of each redirect, so they never follow a redirect to another host.
+type HTTPAuth struct {
+	// Host is the host the credentials are for, with its port if it is not
+	// the default one. A leading "*." matches any of its subdomains.
+	Host string
+
+	// Token is sent as a bearer token. TokenEnv names an environment
+	// variable to read it from instead.
+	Token    string
+	TokenEnv string
+
+	// Username and Password are sent with basic authentication when there
+	// is no token. PasswordEnv names an environment variable to read the
+	// password from instead.
+	Username    string
+	Password    string
+	PasswordEnv string
+}
+
+// matches reports whether the credentials are for the host, and how
+// specifically: exact matches win over subdomain matches.
+func (a HTTPAuth) matches(host string) (bool, int) {
+	pattern := strings.ToLower(a.Host)
+	host = strings.ToLower(host)
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix), len(suffix)
+	}
+	return pattern == host, len(pattern) + 1
+}
+
+// authorize sets the credentials on the request.
+func (a HTTPAuth) authorize(req *http.Request) error {
+	token := a.Token
+	if a.TokenEnv != "" {
+		token = os.Getenv(a.TokenEnv)
+		if token == "" {
+			return fmt.Errorf("credentials for %s: %s is not set", a.Host, a.TokenEnv)
+		}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+
+	password := a.Password
+	if a.PasswordEnv != "" {
+		password = os.Getenv(a.PasswordEnv)
+		if password == "" {
+			return fmt.Errorf("credentials for %s: %s is not set", a.Host, a.PasswordEnv)
+		}
+	}
+	req.SetBasicAuth(a.Username, password)
+	return nil
+}
+
+// authEntry is an entry of credentials: the credentials for a host, or the
+// error parsing them.
+type authEntry struct {
+	auth HTTPAuth
+	err  error
+}
+
+// CheckAuthEnv reports the entries of the AuthEnv environment variable that
+// cannot be parsed. Fetches fail on them only when they need credentials for
+// the host of such an entry, so this is for checking the variable upfront.
+func CheckAuthEnv() error {
+	var errs []error
+	for _, entry := range parseAuthEnv(os.Getenv(AuthEnv)) {
+		errs = append(errs, entry.err)
+	}
+	return errors.Join(errs...)
+}
+
+// parseAuthEnv parses credentials in the format of AuthEnv. Entries that
+// cannot be parsed hold the error, which never includes the credentials
+// themselves.
+func parseAuthEnv(value string) []authEntry {
+	var entries []authEntry
+	for i, entry := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	}) {
+		host, credentials, ok := strings.Cut(entry, "=")
+		if !ok || host == "" {
+			entries = append(entries, authEntry{err: fmt.Errorf("%s: entry %d: expected HOST=bearer:TOKEN or HOST=basic:USERNAME:PASSWORD", AuthEnv, i+1)})
+			continue
+		}
+		auth := HTTPAuth{Host: host}
+		var err error
+		scheme, secret, _ := strings.Cut(credentials, ":")
+		switch scheme {
+		case "bearer":
+			auth.Token = secret
+			if secret == "" {
+				err = fmt.Errorf("%s: entry for %s has no token", AuthEnv, host)
+			}
+		case "basic":
+			var ok bool
+			auth.Username, auth.Password, ok = strings.Cut(secret, ":")
+			if !ok || auth.Username == "" {
+				err = fmt.Errorf("%s: entry for %s has no USERNAME:PASSWORD", AuthEnv, host)
+			}
+		default:
+			err = fmt.Errorf("%s: entry for %s must use bearer or basic", AuthEnv, host)
+		}
+		if err != nil {
+			// Keep only the host, to report the error for.
+			auth = HTTPAuth{Host: host}
+		}
+		entries = append(entries, authEntry{auth: auth, err: err})
+	}
+	return entries
+}
+
+// authTransport adds the credentials for the host of each request it makes.
+type authTransport struct {
+	base http.RoundTripper
+
+	// auths are the credentials to use, and fallback those to use for
+	// hosts none of them match.
+	auths    []authEntry
+	fallback []authEntry
+}
+
+func newAuthTransport(base http.RoundTripper, auths []HTTPAuth, fallback []authEntry) *authTransport {
+	t := &authTransport{base: base, fallback: fallback}
+	for _, auth := range auths {
+		t.auths = append(t.auths, authEntry{auth: auth})
+	}
+	return t
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	auth, ok, err := t.authFor(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	if err := auth.authorize(req); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// authFor returns the most specific credentials for the URL, if it may be
+// sent credentials at all, or the error parsing them.
+func (t *authTransport) authFor(u *url.URL) (HTTPAuth, bool, error) {
+	if u.Scheme != "https" && !isLoopback(u.Hostname()) {
+		return HTTPAuth{}, false, nil
+	}
+	entry, ok := bestAuth(t.auths, u.Host)
+	if !ok {
+		entry, ok = bestAuth(t.fallback, u.Host)
+	}
+	return entry.auth, ok && entry.err == nil, entry.err
+}
+
+func bestAuth(entries []authEntry, host string) (authEntry, bool) {
+	var best authEntry
+	bestScore := 0
+	for _, entry := range entries {
+		if ok, score := entry.auth.matches(host); ok && score > bestScore {
+			best, bestScore = entry, score
+		}
+	}
+	return best, bestScore > 0
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// RedactedSource returns the source of a document for logging, with any
+// credentials in it redacted as they are in the errors of this package.
+func RedactedSource(source string) string {
+	u, err := url.Parse(source)
+	if err != nil || !isRemote(u) {
+		return source
+	}
+	return redactedURL(u)
+}
+
+// redactedURL returns the URL for logging, without any password or query
+// parameter values, which may hold credentials.
+func redactedURL(u *url.URL) string {
+	redacted := *u
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query[key] = []string{"xxxxx"}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.Redacted()
+}
@@ -0,0 +1,137 @@
+package decode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Environment variables configuring the cache when HTTPOptions do not.
+const (
+	// CacheDirEnv names the directory remote documents are cached in.
+	CacheDirEnv = "SPICEDB_VALIDATION_CACHE_DIR"
+
+	// OfflineEnv, when true, serves remote documents only from the cache.
+	OfflineEnv = "SPICEDB_VALIDATION_OFFLINE"
+)
+
+// DefaultCacheTTL is how long a cached file is used without revalidating it.
+const DefaultCacheTTL = 5 * time.Minute
+
+// ErrNotCached is returned when fetching is off and a remote file is not in
+// the cache.
+var ErrNotCached = errors.New("not in the cache, and fetching is off")
+
+// cache keeps fetched files on disk, keyed by URL.
+type cache struct {
+	dir     string
+	ttl     time.Duration
+	offline bool
+}
+
+// newCache returns the cache the options describe, or nil if they describe
+// none.
+func newCache(opts HTTPOptions) (*cache, error) {
+	dir := opts.CacheDir
+	if dir == "" {
+		dir = os.Getenv(CacheDirEnv)
+	}
+	offline := opts.Offline
+	if value := os.Getenv(OfflineEnv); !offline && value != "" {
+		var err error
+		if offline, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("%s: %w", OfflineEnv, err)
+		}
+	}
+
+	switch {
+	case dir == "" && offline:
+		return nil, errors.New("offline mode needs a cache directory")
+	case dir == "":
+		return nil, nil
+	}
+
+	ttl := opts.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &cache{dir: dir, ttl: ttl, offline: offline}, nil
+}
+
+// cacheEntry is a cached file, along with what is needed to revalidate it.
+type cacheEntry struct {
+	// URL is the URL the file was fetched from, redacted, for reference.
+	URL string `json:"url"`
+
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+
+	// Data is the file itself, stored along with the rest of the entry so
+	// that the two are always replaced together.
+	Data []byte `json:"data"`
+}
+
+// fresh reports whether the entry can be used without revalidating it.
+func (c *cache) fresh(entry *cacheEntry) bool {
+	return c.ttl > 0 && time.Since(entry.FetchedAt) < c.ttl
+}
+
+// path returns the path of the entry cached for the URL.
+func (c *cache) path(u *url.URL) string {
+	sum := sha256.Sum256([]byte(u.String()))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load returns the entry cached for the URL, or nil if there is none or it
+// cannot be read.
+func (c *cache) load(u *url.URL) *cacheEntry {
+	raw, err := os.ReadFile(c.path(u))
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+// store caches the entry for the URL. Files are written readable only by
+// the user, as they may have been fetched with credentials.
+func (c *cache) store(u *url.URL, entry *cacheEntry) error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path(u), raw)
+}
+
+// writeFileAtomic writes the file by renaming a temporary file over it, so
+// that concurrent readers never see it partly written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
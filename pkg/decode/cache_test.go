@@ -0,0 +1,81 @@
+package decode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPDecoderCache(t *testing.T) {
+	var requests, modified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			modified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("schema: definition user {}\n"))
+	}))
+	defer server.Close()
+
+	decodeURL := func(path string, opts HTTPOptions) (map[string]string, error) {
+		u, err := url.Parse(server.URL + path)
+		require.NoError(t, err)
+		d, err := DecoderForURLWithOptions(u, opts)
+		require.NoError(t, err)
+		var out map[string]string
+		_, err = d(context.Background(), &out)
+		return out, err
+	}
+	dir := t.TempDir()
+
+	// A fresh entry is used without asking the server.
+	for i := 0; i < 2; i++ {
+		out, err := decodeURL("/document.yaml", HTTPOptions{CacheDir: dir})
+		require.NoError(t, err)
+		require.Equal(t, "definition user {}", out["schema"])
+	}
+	require.EqualValues(t, 1, requests.Load())
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	// A stale one is revalidated, and kept when unchanged.
+	out, err := decodeURL("/document.yaml", HTTPOptions{CacheDir: dir, CacheTTL: -1})
+	require.NoError(t, err)
+	require.Equal(t, "definition user {}", out["schema"])
+	require.EqualValues(t, 2, requests.Load())
+	require.EqualValues(t, 1, modified.Load())
+
+	// Offline, the cache is used whatever the age of the entry.
+	t.Setenv(OfflineEnv, "true")
+	out, err = decodeURL("/document.yaml", HTTPOptions{CacheDir: dir, CacheTTL: -1})
+	require.NoError(t, err)
+	require.Equal(t, "definition user {}", out["schema"])
+	require.EqualValues(t, 2, requests.Load())
+
+	_, err = decodeURL("/other.yaml", HTTPOptions{CacheDir: dir})
+	require.ErrorIs(t, err, ErrNotCached)
+	require.EqualValues(t, 2, requests.Load())
+
+	_, err = decodeURL("/document.yaml", HTTPOptions{})
+	require.ErrorContains(t, err, "offline mode needs a cache directory")
+}
+
+func TestCacheFresh(t *testing.T) {
+	c := &cache{ttl: time.Minute}
+	require.True(t, c.fresh(&cacheEntry{FetchedAt: time.Now()}))
+	require.False(t, c.fresh(&cacheEntry{FetchedAt: time.Now().Add(-2 * time.Minute)}))
+
+	c.ttl = -1
+	require.False(t, c.fresh(&cacheEntry{FetchedAt: time.Now()}))
+}
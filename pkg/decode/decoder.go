@@ -12,64 +12,109 @@
 package decode
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 
-	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
-var playgroundPattern = regexp.MustCompile("^.*/s/.*/schema|relationships|assertions|expected.*$")
+var (
+	playgroundPattern      = regexp.MustCompile("^.*/s/[^/]+/(schema|relationships|assertions|expected)[^/]*$")
+	playgroundSharePattern = regexp.MustCompile("^/s/[^/]+/?$")
+)
+
+// playgroundHost serves the Playground, whose share links name no tab.
+const playgroundHost = "play.authzed.com"
 
 // SchemaRelationships holds the schema (as a string) and a list of
-// relationships (as a string) in the format from the devtools download API.
+// relationships (as a string) in the format from the devtools download API,
+// along with the assertions and expected relations, which it holds as YAML
+// strings. Decoders convert documents in this format into validation
+// documents, unless decoding into a SchemaRelationships.
 type SchemaRelationships struct {
-	Schema        string `yaml:"schema"`
-	Relationships string `yaml:"relationships"`
+	Schema            string `yaml:"schema"`
+	Relationships     string `yaml:"relationships"`
+	Assertions        string `yaml:"assertions"`
+	ExpectedRelations string `yaml:"validation"`
 }
 
-// Func will decode into the supplied object.
-type Func func(out interface{}) ([]byte, error)
+// Func will decode into the supplied object. The context bounds any I/O
+// needed to fetch the document.
+type Func func(ctx context.Context, out interface{}) ([]byte, error)
 
 // DecoderForURL returns the appropriate decoder for a given URL.
 // Some URLs have special handling to dereference to the actual file.
 func DecoderForURL(u *url.URL) (d Func, err error) {
+	return DecoderForURLWithOptions(u, HTTPOptions{})
+}
+
+// DecoderForURLWithOptions is DecoderForURL, fetching remote documents as
+// the options say.
+func DecoderForURLWithOptions(u *url.URL, opts HTTPOptions) (d Func, err error) {
+	f := newFetcher(opts)
 	switch s := u.Scheme; s {
 	case "file":
-		d = fileDecoder(u)
+		d = fileDecoder(f, u)
 	case "http", "https":
-		d = httpDecoder(u)
+		d = httpDecoder(f, u)
 	case "":
-		d = fileDecoder(u)
+		d = fileDecoder(f, u)
 	default:
 		err = fmt.Errorf("%s scheme not supported", s)
 	}
 	return
 }
 
-func fileDecoder(u *url.URL) Func {
-	return func(out interface{}) ([]byte, error) {
-		file, err := os.Open(u.Path)
-		if err != nil {
-			return nil, err
+// BytesDecoder returns a decoder for a document that is already in memory.
+// Files it references are resolved against the working directory.
+func BytesDecoder(data []byte) Func {
+	return BytesDecoderWithOptions(data, HTTPOptions{})
+}
+
+// BytesDecoderWithOptions is BytesDecoder, fetching remote files the
+// document references as the options say.
+func BytesDecoderWithOptions(data []byte, opts HTTPOptions) Func {
+	f := newFetcher(opts)
+	return func(ctx context.Context, out interface{}) ([]byte, error) {
+		return data, decodeDocument(ctx, f, nil, data, out)
+	}
+}
+
+func fileDecoder(f *fetcher, u *url.URL) Func {
+	return func(ctx context.Context, out interface{}) ([]byte, error) {
+		if NamesSeveral(u) {
+			return nil, fmt.Errorf("%s names several documents; expand it with ExpandURL", u.Path)
 		}
-		data, err := io.ReadAll(file)
+		data, err := readFile(ctx, u)
 		if err != nil {
 			return nil, err
 		}
-		return data, yaml.Unmarshal(data, out)
+		return data, decodeDocument(ctx, f, u, data, out)
 	}
 }
 
-func httpDecoder(u *url.URL) Func {
+func readFile(ctx context.Context, u *url.URL) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(u.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func httpDecoder(f *fetcher, u *url.URL) Func {
 	rewriteURL(u)
-	return directHTTPDecoder(u)
+	return directHTTPDecoder(f, u)
 }
 
 func rewriteURL(u *url.URL) {
@@ -79,6 +124,10 @@ func rewriteURL(u *url.URL) {
 		u.Path += "/download"
 		return
 	}
+	if u.Hostname() == playgroundHost && playgroundSharePattern.MatchString(u.Path) {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/download"
+		return
+	}
 
 	switch u.Hostname() {
 	case "gist.github.com":
@@ -92,19 +141,71 @@ func rewriteURL(u *url.URL) {
 	}
 }
 
-func directHTTPDecoder(u *url.URL) Func {
-	return func(out interface{}) ([]byte, error) {
-		log.Debug().Stringer("url", u).Send()
-		r, err := http.Get(u.String())
+func directHTTPDecoder(f *fetcher, u *url.URL) Func {
+	return func(ctx context.Context, out interface{}) ([]byte, error) {
+		data, err := f.readHTTP(ctx, u)
 		if err != nil {
 			return nil, err
 		}
-		defer r.Body.Close()
-		data, err := io.ReadAll(r.Body)
-		if err != nil {
-			return nil, err
+		return data, decodeDocument(ctx, f, u, data, out)
+	}
+}
+
+// SyntaxError is returned by decoders when the document was read but could
+// not be unmarshalled, as opposed to when it could not be read at all.
+type SyntaxError struct {
+	Err error
+
+	// Line is the line of the document the error was found on, counting
+	// from 1, or 0 when it is not known.
+	Line int
+}
+
+// errorLine matches the line number YAML errors, and ours, start with.
+var errorLine = regexp.MustCompile(`(?:^|yaml: |\n  )line (\d+): `)
+
+// newSyntaxError returns a SyntaxError for err, taking its line from the
+// message.
+func newSyntaxError(err error) *SyntaxError {
+	syntaxErr := &SyntaxError{Err: err}
+	if match := errorLine.FindStringSubmatch(err.Error()); match != nil {
+		syntaxErr.Line, _ = strconv.Atoi(match[1])
+	}
+	return syntaxErr
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// unmarshal decodes the YAML data into out. The validation file types run
+// their own parsing while unmarshalling, so a panic there is returned as an
+// error rather than propagated.
+func unmarshal(data []byte, out interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newSyntaxError(fmt.Errorf("failed to decode document: %v", r))
 		}
+	}()
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return newSyntaxError(err)
+	}
+	return nil
+}
 
-		return data, yaml.Unmarshal(data, out)
+// decodeNode is unmarshal for an already parsed node.
+func decodeNode(node *yaml.Node, out interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newSyntaxError(fmt.Errorf("failed to decode document: %v", r))
+		}
+	}()
+	if err := node.Decode(out); err != nil {
+		return newSyntaxError(err)
 	}
+	return nil
 }
@@ -12,10 +12,16 @@
 package decode
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/authzed/spicedb/pkg/validationfile"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestRewriteURL(t *testing.T) {
@@ -89,6 +95,32 @@ func TestRewriteURL(t *testing.T) {
 				Path:   "/s/KY7TEKLs5_9R/download",
 			},
 		},
+		{
+			name: "playground share link",
+			in: url.URL{
+				Scheme: "https",
+				Host:   "play.authzed.com",
+				Path:   "/s/KY7TEKLs5_9R",
+			},
+			out: url.URL{
+				Scheme: "https",
+				Host:   "play.authzed.com",
+				Path:   "/s/KY7TEKLs5_9R/download",
+			},
+		},
+		{
+			name: "not a playground tab",
+			in: url.URL{
+				Scheme: "https",
+				Host:   "somethingelse.com",
+				Path:   "/fixtures/relationships.yaml",
+			},
+			out: url.URL{
+				Scheme: "https",
+				Host:   "somethingelse.com",
+				Path:   "/fixtures/relationships.yaml",
+			},
+		},
 		{
 			name: "pastebin",
 			in: url.URL{
@@ -137,3 +169,98 @@ func TestRewriteURL(t *testing.T) {
 		})
 	}
 }
+
+func TestBytesDecoder(t *testing.T) {
+	data := []byte("schema: |-\n  definition user {}\n")
+
+	var out map[string]string
+	contents, err := BytesDecoder(data)(context.Background(), &out)
+	require.NoError(t, err)
+	require.Equal(t, data, contents)
+	require.Equal(t, "definition user {}", out["schema"])
+
+	contents, err = BytesDecoder([]byte("schema: [\n"))(context.Background(), &out)
+	require.Error(t, err)
+	require.Equal(t, []byte("schema: [\n"), contents)
+}
+
+type panickingValue struct{}
+
+func (p *panickingValue) UnmarshalYAML(*yaml.Node) error {
+	panic("invalid tuple")
+}
+
+func TestDecoderRecoversPanics(t *testing.T) {
+	var out struct {
+		Value panickingValue `yaml:"value"`
+	}
+	_, err := BytesDecoder([]byte("value: x\n"))(context.Background(), &out)
+	require.ErrorContains(t, err, "invalid tuple")
+}
+
+func TestHTTPDecoderCancellation(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	u, err := url.Parse(server.URL + "/document.yaml")
+	require.NoError(t, err)
+	decoder, err := DecoderForURL(u)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var out map[string]string
+	_, err = decoder(ctx, &out)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPlaygroundDownload(t *testing.T) {
+	download, err := yaml.Marshal(&SchemaRelationships{
+		Schema:            "definition user {}\n\ndefinition document {\n  relation viewer: user\n}",
+		Relationships:     "document:plan#viewer@user:alice\ndocument:plan#viewer@user:bob",
+		Assertions:        "assertTrue:\n  - document:plan#viewer@user:alice\n",
+		ExpectedRelations: "document:plan#viewer:\n  - '[user:alice] is <document:plan#viewer>'\n",
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/s/KY7TEKLs5_9R/download", r.URL.Path)
+		_, _ = w.Write(download)
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/s/KY7TEKLs5_9R/relationships")
+	require.NoError(t, err)
+	decoder, err := DecoderForURL(u)
+	require.NoError(t, err)
+
+	var parsed validationfile.ValidationFile
+	contents, err := decoder(context.Background(), &parsed)
+	require.NoError(t, err)
+	require.Equal(t, download, contents)
+	require.Contains(t, parsed.Schema.Schema, "definition document")
+	require.Len(t, parsed.Relationships.Relationships, 2)
+	require.Len(t, parsed.Assertions.AssertTrue, 1)
+	require.Equal(t, 12, parsed.Assertions.AssertTrue[0].SourcePosition.LineNumber)
+	require.Len(t, parsed.ExpectedRelations.ValidationMap, 1)
+
+	var raw SchemaRelationships
+	_, err = BytesDecoder(download)(context.Background(), &raw)
+	require.NoError(t, err)
+	require.Equal(t, "assertTrue:\n  - document:plan#viewer@user:alice\n", raw.Assertions)
+
+	_, err = BytesDecoder([]byte("schema: definition user {}\nassertions: \"assertTrue: [\"\nvalidation: \"\"\n"))(context.Background(), &parsed)
+	var syntaxErr *SyntaxError
+	require.ErrorAs(t, err, &syntaxErr)
+	require.ErrorContains(t, err, "line 2: assertions")
+	require.Equal(t, 2, syntaxErr.Line)
+
+	_, err = BytesDecoder([]byte("schema: definition user {}\nrelationships: [\n"))(context.Background(), &parsed)
+	require.ErrorAs(t, err, &syntaxErr)
+	require.Equal(t, 2, syntaxErr.Line)
+}
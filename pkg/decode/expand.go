@@ -0,0 +1,164 @@
+package decode
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// documentExtensions are the extensions of the files a directory expands to.
+var documentExtensions = []string{".yaml", ".yml"}
+
+// ExpandURL returns the documents a URL refers to. A file URL or path naming
+// a directory expands to the YAML files under it, and one containing a glob
+// pattern to the files matching it, where `**` matches any number of
+// directories. Both are expanded in lexical order. Any other URL refers to a
+// single document, itself.
+func ExpandURL(u *url.URL) ([]*url.URL, error) {
+	if !NamesSeveral(u) {
+		return []*url.URL{u}, nil
+	}
+
+	var paths []string
+	switch {
+	case isGlob(u.Path):
+		matches, err := glob(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no documents match %s", u.Path)
+		}
+		paths = matches
+	default:
+		found, err := documentsIn(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no documents found in %s", u.Path)
+		}
+		paths = found
+	}
+
+	urls := make([]*url.URL, len(paths))
+	for i, p := range paths {
+		urls[i] = &url.URL{Scheme: u.Scheme, Path: p}
+	}
+	return urls, nil
+}
+
+// NamesSeveral reports whether the URL is a file URL or path naming a
+// directory or containing a glob pattern, which ExpandURL expands into the
+// documents it stands for, rather than a single document.
+func NamesSeveral(u *url.URL) bool {
+	return (u.Scheme == "" || u.Scheme == "file") && (isGlob(u.Path) || isDir(u.Path))
+}
+
+func isGlob(p string) bool {
+	return strings.ContainsAny(p, "*[")
+}
+
+func isDir(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
+
+// documentsIn returns the YAML files under the directory, recursively.
+func documentsIn(dir string) ([]string, error) {
+	var found []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && isDocument(p) {
+			found = append(found, filepath.ToSlash(p))
+		}
+		return nil
+	})
+	return found, err
+}
+
+func isDocument(p string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	for _, documentExt := range documentExtensions {
+		if ext == documentExt {
+			return true
+		}
+	}
+	return false
+}
+
+// glob returns the files matching the pattern. It walks the directory
+// preceding the first segment with a wildcard, matching what is below it
+// segment by segment.
+func glob(pattern string) ([]string, error) {
+	segments := strings.Split(pattern, "/")
+	base := 0
+	for base < len(segments) && !isGlob(segments[base]) {
+		base++
+	}
+	for _, segment := range segments[base:] {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+	}
+
+	prefix := strings.Join(segments[:base], "/")
+	if prefix == "" && strings.HasPrefix(pattern, "/") {
+		prefix = "/"
+	}
+	root := prefix
+	if root == "" {
+		root = "."
+	}
+	if !isDir(root) {
+		return nil, nil
+	}
+
+	var matches []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if matchSegments(segments[base:], strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, path.Join(prefix, filepath.ToSlash(rel)))
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// matchSegments reports whether the path segments match the pattern
+// segments, where a `**` segment matches any number of path segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
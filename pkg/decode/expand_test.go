@@ -0,0 +1,81 @@
+package decode
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandURL(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"a.yaml",
+		"b.yml",
+		"notes.txt",
+		"nested/c.yaml",
+		"nested/deeper/d.yaml",
+		"other/e.yaml",
+	} {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o700))
+		require.NoError(t, os.WriteFile(p, nil, 0o600))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "empty"), 0o700))
+	root := filepath.ToSlash(dir)
+
+	tests := []struct {
+		name    string
+		url     string
+		want    []string
+		wantErr string
+	}{
+		{"file", root + "/a.yaml", []string{root + "/a.yaml"}, ""},
+		{"http", "https://example.com/authz/*.yaml", []string{"https://example.com/authz/*.yaml"}, ""},
+		{"directory", root + "/nested", []string{root + "/nested/c.yaml", root + "/nested/deeper/d.yaml"}, ""},
+		{"directory url", "file://" + root + "/nested", []string{"file://" + root + "/nested/c.yaml", "file://" + root + "/nested/deeper/d.yaml"}, ""},
+		{"glob", root + "/*.y*ml", []string{root + "/a.yaml", root + "/b.yml"}, ""},
+		{"double star", root + "/**/*.yaml", []string{
+			root + "/a.yaml",
+			root + "/nested/c.yaml",
+			root + "/nested/deeper/d.yaml",
+			root + "/other/e.yaml",
+		}, ""},
+		{"double star in the middle", root + "/nested/**/d.yaml", []string{root + "/nested/deeper/d.yaml"}, ""},
+		{"character class", root + "/[ab].yaml", []string{root + "/a.yaml"}, ""},
+		{"no match", root + "/*.json", nil, "no documents match"},
+		{"empty directory", root + "/empty", nil, "no documents found"},
+		{"invalid pattern", root + "/[.yaml", nil, "invalid pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+
+			urls, err := ExpandURL(u)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			var got []string
+			for _, u := range urls {
+				got = append(got, u.String())
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFileDecoderRejectsSeveralDocuments(t *testing.T) {
+	d, err := DecoderForURL(&url.URL{Path: t.TempDir()})
+	require.NoError(t, err)
+
+	_, err = d(context.Background(), &SchemaRelationships{})
+	require.ErrorContains(t, err, "names several documents")
+}
@@ -0,0 +1,362 @@
+package decode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Defaults of HTTPOptions.
+const (
+	DefaultHTTPTimeout      = 30 * time.Second
+	DefaultMaxBodySize      = 10 << 20
+	DefaultHTTPRetries      = 2
+	DefaultHTTPRetryBackoff = 250 * time.Millisecond
+	DefaultMaxRedirects     = 10
+)
+
+// maxRetryAfter caps how long a Retry-After header can make a retry wait.
+const maxRetryAfter = 30 * time.Second
+
+// HTTPOptions configure how documents, and the files they reference, are
+// fetched over HTTP. Zero values take the defaults.
+type HTTPOptions struct {
+	// Timeout bounds each attempt at fetching a file, including reading its
+	// body.
+	Timeout time.Duration
+
+	// MaxBodySize is the size in bytes of the largest file that is read.
+	MaxBodySize int64
+
+	// Retries is how many more times a fetch that failed transiently is
+	// attempted: on network errors, and on 408, 429, 500, 502, 503 and 504
+	// responses. Negative values disable retries.
+	Retries int
+
+	// RetryBackoff is how long to wait before the first retry, doubling
+	// before each one after it. A Retry-After header takes precedence.
+	RetryBackoff time.Duration
+
+	// MaxRedirects is how many redirects are followed. Negative values
+	// follow none. Redirects from https to http are never followed.
+	MaxRedirects int
+
+	// Auth holds credentials for the hosts that need them. Those given in
+	// the AuthEnv environment variable are used for hosts none of these
+	// match.
+	Auth []HTTPAuth
+
+	// CacheDir, when set, is the directory fetched files are cached in,
+	// keyed by URL; the CacheDirEnv environment variable is used otherwise.
+	// Without either, nothing is cached.
+	CacheDir string
+
+	// CacheTTL is how long a cached file is used before it is revalidated
+	// with the server, which only sends it again if it has changed.
+	// Negative values revalidate every time.
+	CacheTTL time.Duration
+
+	// Offline serves files only from the cache, whatever their age, failing
+	// with ErrNotCached for those that are not. It is also turned on by the
+	// OfflineEnv environment variable, and needs a cache directory.
+	Offline bool
+}
+
+func (o HTTPOptions) withDefaults() HTTPOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultHTTPTimeout
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = DefaultMaxBodySize
+	}
+	switch {
+	case o.Retries == 0:
+		o.Retries = DefaultHTTPRetries
+	case o.Retries < 0:
+		o.Retries = 0
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = DefaultHTTPRetryBackoff
+	}
+	switch {
+	case o.MaxRedirects == 0:
+		o.MaxRedirects = DefaultMaxRedirects
+	case o.MaxRedirects < 0:
+		o.MaxRedirects = 0
+	}
+	return o
+}
+
+// HTTPError is returned when a file is fetched with a response other than
+// 2xx.
+type HTTPError struct {
+	// URL is the URL that responded, after any redirects, with any
+	// credentials in it redacted.
+	URL string
+
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("fetching %s: %s", e.URL, e.Status)
+}
+
+// transient reports whether the request may succeed if retried.
+func (e *HTTPError) transient() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// redirectError is a redirect refused by the redirect policy.
+type redirectError struct {
+	reason string
+}
+
+func (e *redirectError) Error() string {
+	return e.reason
+}
+
+// fetcher reads the files decoders need, locally or over HTTP.
+type fetcher struct {
+	opts   HTTPOptions
+	client *http.Client
+
+	// cache is nil when fetched files are not cached.
+	cache *cache
+
+	// err is an error configuring the fetcher, returned by every fetch.
+	err error
+}
+
+func newFetcher(opts HTTPOptions) *fetcher {
+	opts = opts.withDefaults()
+	c, err := newCache(opts)
+	return &fetcher{
+		opts:  opts,
+		cache: c,
+		err:   err,
+		client: &http.Client{
+			Transport: newAuthTransport(http.DefaultTransport, opts.Auth, parseAuthEnv(os.Getenv(AuthEnv))),
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if opts.MaxRedirects == 0 {
+					return &redirectError{fmt.Sprintf("not following redirect to %s", redactedURL(req.URL))}
+				}
+				if len(via) > opts.MaxRedirects {
+					return &redirectError{fmt.Sprintf("stopped after %d redirects", opts.MaxRedirects)}
+				}
+				if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme != "https" {
+					return &redirectError{fmt.Sprintf("refusing to follow redirect from https to %s", req.URL.Scheme)}
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// read returns the contents of the file at the URL.
+func (f *fetcher) read(ctx context.Context, u *url.URL) ([]byte, error) {
+	switch u.Scheme {
+	case "", "file":
+		return readFile(ctx, u)
+	case "http", "https":
+		return f.readHTTP(ctx, u)
+	default:
+		return nil, fmt.Errorf("%s scheme not supported", u.Scheme)
+	}
+}
+
+// readHTTP fetches the file at the URL, from the cache if there is one and
+// it holds the file.
+func (f *fetcher) readHTTP(ctx context.Context, u *url.URL) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.cache == nil {
+		resp, err := f.fetchRetrying(ctx, u, nil)
+		return resp.data, err
+	}
+
+	cached := f.cache.load(u)
+	switch {
+	case f.cache.offline && cached == nil:
+		return nil, fmt.Errorf("%s: %w", redactedURL(u), ErrNotCached)
+	case f.cache.offline, cached != nil && f.cache.fresh(cached):
+		log.Debug().Str("url", redactedURL(u)).Msg("cached")
+		return cached.Data, nil
+	}
+
+	resp, err := f.fetchRetrying(ctx, u, cached)
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{
+		URL:          redactedURL(u),
+		ETag:         resp.etag,
+		LastModified: resp.lastModified,
+		FetchedAt:    time.Now(),
+		Data:         resp.data,
+	}
+	if resp.notModified {
+		entry.Data = cached.Data
+		if entry.ETag == "" && entry.LastModified == "" {
+			entry.ETag, entry.LastModified = cached.ETag, cached.LastModified
+		}
+	}
+	if err := f.cache.store(u, entry); err != nil {
+		// The file was fetched all the same.
+		log.Debug().Str("url", redactedURL(u)).Err(err).Msg("caching failed")
+	}
+	return entry.Data, nil
+}
+
+// response is a successful response to a fetch.
+type response struct {
+	data []byte
+
+	// etag and lastModified are the validators of the response, if any.
+	etag         string
+	lastModified string
+
+	// notModified is set when the file is unchanged from the cached entry
+	// the fetch was conditional on, and data is then empty.
+	notModified bool
+}
+
+// fetchRetrying fetches the file at the URL, retrying transient failures.
+// If cached is not nil, the fetch is conditional on the file having changed
+// since it was cached.
+func (f *fetcher) fetchRetrying(ctx context.Context, u *url.URL, cached *cacheEntry) (response, error) {
+	backoff := f.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, retryAfter, err := f.fetch(ctx, u, cached)
+		if err == nil || attempt >= f.opts.Retries || !retryable(ctx, err) {
+			return resp, err
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = min(retryAfter, maxRetryAfter)
+		}
+		log.Debug().Str("url", redactedURL(u)).Err(err).Dur("wait", wait).Msg("retrying")
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return response{}, ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// fetch makes a single attempt at fetching the file at the URL, returning
+// how long the server asked to wait before retrying, if it did.
+func (f *fetcher) fetch(ctx context.Context, u *url.URL, cached *cacheEntry) (response, time.Duration, error) {
+	log.Debug().Str("url", redactedURL(u)).Send()
+	ctx, cancel := context.WithTimeout(ctx, f.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return response{}, 0, err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	r, err := f.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			// The error names the URL that failed, which may be a redirect.
+			failed, parseErr := url.Parse(urlErr.URL)
+			if parseErr != nil {
+				failed = u
+			}
+			urlErr.URL = redactedURL(failed)
+		}
+		return response{}, 0, err
+	}
+	defer r.Body.Close()
+
+	resp := response{etag: r.Header.Get("ETag"), lastModified: r.Header.Get("Last-Modified")}
+	if r.StatusCode == http.StatusNotModified && cached != nil {
+		resp.notModified = true
+		return resp, 0, nil
+	}
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return response{}, retryAfter(r.Header.Get("Retry-After")), &HTTPError{
+			URL:        redactedURL(r.Request.URL),
+			StatusCode: r.StatusCode,
+			Status:     r.Status,
+		}
+	}
+
+	resp.data, err = io.ReadAll(io.LimitReader(r.Body, f.opts.MaxBodySize+1))
+	if err != nil {
+		return response{}, 0, err
+	}
+	if int64(len(resp.data)) > f.opts.MaxBodySize {
+		return response{}, 0, fmt.Errorf("%s is larger than %d bytes", redactedURL(r.Request.URL), f.opts.MaxBodySize)
+	}
+	return resp, 0, nil
+}
+
+// retryable reports whether a failed fetch is worth retrying: the call has
+// not been canceled, and the failure is a transient response or a network
+// error other than a refused redirect.
+func retryable(ctx context.Context, err error) bool {
+	var redirectErr *redirectError
+	if ctx.Err() != nil || errors.As(err, &redirectErr) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.transient()
+	}
+
+	// Errors making the request are wrapped in a *url.Error, which is a
+	// net.Error itself whatever the cause.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryAfter parses a Retry-After header given in seconds, returning zero if
+// it is absent or in any other form.
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
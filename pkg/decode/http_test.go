@@ -0,0 +1,81 @@
+package decode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPDecoderErrors(t *testing.T) {
+	var flaky atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved.yaml":
+			http.Redirect(w, r, "/missing.yaml", http.StatusFound)
+		case "/loop.yaml":
+			http.Redirect(w, r, "/loop.yaml", http.StatusFound)
+		case "/flaky.yaml":
+			if flaky.Add(1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("schema: definition user {}\n"))
+		case "/large.yaml":
+			_, _ = w.Write([]byte("schema: " + strings.Repeat("x", 100) + "\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	decodeURL := func(path string, opts HTTPOptions) (map[string]string, error) {
+		u, err := url.Parse(server.URL + path)
+		require.NoError(t, err)
+		d, err := DecoderForURLWithOptions(u, opts)
+		require.NoError(t, err)
+		var out map[string]string
+		_, err = d(context.Background(), &out)
+		return out, err
+	}
+	fast := HTTPOptions{RetryBackoff: time.Millisecond}
+
+	_, err := decodeURL("/moved.yaml", fast)
+	var httpErr *HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+	require.Equal(t, server.URL+"/missing.yaml", httpErr.URL)
+	require.EqualError(t, err, "fetching "+server.URL+"/missing.yaml: 404 Not Found")
+
+	out, err := decodeURL("/flaky.yaml", fast)
+	require.NoError(t, err)
+	require.Equal(t, "definition user {}", out["schema"])
+	require.EqualValues(t, 3, flaky.Load())
+
+	flaky.Store(0)
+	_, err = decodeURL("/flaky.yaml", HTTPOptions{Retries: -1})
+	require.ErrorAs(t, err, &httpErr)
+	require.Equal(t, http.StatusServiceUnavailable, httpErr.StatusCode)
+	require.EqualValues(t, 1, flaky.Load())
+
+	_, err = decodeURL("/large.yaml", HTTPOptions{MaxBodySize: 50})
+	require.ErrorContains(t, err, "larger than 50 bytes")
+
+	_, err = decodeURL("/loop.yaml", HTTPOptions{MaxRedirects: 3})
+	require.ErrorContains(t, err, "stopped after 3 redirects")
+
+	_, err = decodeURL("/moved.yaml", HTTPOptions{MaxRedirects: -1})
+	require.ErrorContains(t, err, "not following redirect to "+server.URL+"/missing.yaml")
+}
+
+func TestRetryAfter(t *testing.T) {
+	require.Equal(t, 2*time.Second, retryAfter("2"))
+	require.Zero(t, retryAfter(""))
+	require.Zero(t, retryAfter("Wed, 21 Oct 2015 07:28:00 GMT"))
+}
@@ -0,0 +1,97 @@
+package decode
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// embeddedKeys are the keys the devtools download API holds as YAML strings
+// rather than as YAML, mapped to the field of SchemaRelationships holding
+// them.
+var embeddedKeys = map[string]func(*SchemaRelationships) string{
+	"assertions": func(s *SchemaRelationships) string { return s.Assertions },
+	"validation": func(s *SchemaRelationships) string { return s.ExpectedRelations },
+}
+
+// isDownload reports whether the document is in the format of the devtools
+// download API, as served for Playground share links, which always holds
+// both assertions and expected relations, as strings.
+func isDownload(mapping *yaml.Node) bool {
+	for key := range embeddedKeys {
+		value := mappingValue(mapping, key)
+		if value == nil || value.Kind != yaml.ScalarNode || value.Tag != "!!str" {
+			return false
+		}
+	}
+	return true
+}
+
+// convertDownload converts a document in the format of the devtools download
+// API into a validation document, parsing the assertions and expected
+// relations it holds as strings. The schema and relationships are kept as
+// they are, and the parsed values are positioned where they are in data, so
+// that errors in any of them point at the right line of the download.
+func convertDownload(data []byte, mapping *yaml.Node) (*yaml.Node, error) {
+	var download SchemaRelationships
+	if err := decodeNode(mapping, &download); err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	converted := &yaml.Node{Kind: yaml.MappingNode, Line: mapping.Line, Column: mapping.Column}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keyNode, valueNode := mapping.Content[i], mapping.Content[i+1]
+		field, ok := embeddedKeys[keyNode.Value]
+		if !ok {
+			converted.Content = append(converted.Content, keyNode, valueNode)
+			continue
+		}
+
+		var root yaml.Node
+		if err := yaml.Unmarshal([]byte(field(&download)), &root); err != nil {
+			return nil, newSyntaxError(fmt.Errorf("line %d: %s: %w", keyNode.Line, keyNode.Value, err))
+		}
+		if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+			continue
+		}
+		value := root.Content[0]
+		positionEmbedded(value, valueNode, lines)
+		converted.Content = append(converted.Content, keyNode, value)
+	}
+	return converted, nil
+}
+
+// positionEmbedded moves the nodes parsed from the string value of a scalar
+// to where they are in the lines of the document holding it. Only literal
+// block scalars keep the lines of the string, as the download API writes
+// them; the nodes of any other scalar are all placed at the scalar itself.
+func positionEmbedded(node, scalar *yaml.Node, lines []string) {
+	if scalar.Style&yaml.LiteralStyle == 0 {
+		walkNodes(node, func(n *yaml.Node) {
+			n.Line, n.Column = scalar.Line, scalar.Column
+		})
+		return
+	}
+
+	// The string starts on the line after the block indicator, indented.
+	indent := 0
+	for _, line := range lines[min(scalar.Line, len(lines)):] {
+		if trimmed := strings.TrimLeft(line, " "); trimmed != "" {
+			indent = len(line) - len(trimmed)
+			break
+		}
+	}
+	walkNodes(node, func(n *yaml.Node) {
+		n.Line += scalar.Line
+		n.Column += indent
+	})
+}
+
+func walkNodes(node *yaml.Node, fn func(*yaml.Node)) {
+	fn(node)
+	for _, child := range node.Content {
+		walkNodes(child, fn)
+	}
+}
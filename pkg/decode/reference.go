@@ -0,0 +1,289 @@
+package decode
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Keys of a document that reference a file holding the value of another key,
+// so that a schema or set of relationships can be shared between documents.
+const (
+	SchemaFileKey        = "schemaFile"
+	RelationshipsFileKey = "relationshipsFile"
+)
+
+// referenceKeys maps each referencing key to the key it stands for.
+var referenceKeys = map[string]string{
+	SchemaFileKey:        "schema",
+	RelationshipsFileKey: "relationships",
+}
+
+// Reference is a file a document referenced in place of a value.
+type Reference struct {
+	// Key is the referencing key, such as SchemaFileKey.
+	Key string
+
+	// Source is the URL of the file the value was read from, with any
+	// credentials in it redacted.
+	Source string
+
+	// Contents is the whole of that file.
+	Contents []byte
+
+	// Line is the line of Contents the value starts after: zero when the
+	// file is the value itself, and the line of its key when the file is
+	// another document holding the value.
+	Line int
+}
+
+// Referrer is told of the files a document referenced. Decoders call
+// AddReference on the referrer of their context, if any, once for each
+// reference they resolve.
+type Referrer interface {
+	AddReference(ref Reference)
+}
+
+type referrerKey struct{}
+
+// WithReferrer returns a context under which decoders tell the referrer of
+// the files the document referenced.
+func WithReferrer(ctx context.Context, referrer Referrer) context.Context {
+	return context.WithValue(ctx, referrerKey{}, referrer)
+}
+
+// ReferenceError is an error reading, or decoding the value read from, a
+// referenced file.
+type ReferenceError struct {
+	Reference Reference
+	Err       error
+}
+
+func (e *ReferenceError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Reference.Key, e.Reference.Source, e.Err)
+}
+
+func (e *ReferenceError) Unwrap() error {
+	return e.Err
+}
+
+// decodeDocument decodes the YAML data of the document at base into out,
+// first converting it from the devtools download format if it is in it, or
+// else replacing each reference to a file with its value. Relative
+// references are resolved against base, or against the working directory
+// when base is nil.
+//
+// A referenced file is the value itself, unless it is a YAML document, in
+// which case the value is taken from the same key of that document, and
+// may in turn be a reference.
+func decodeDocument(ctx context.Context, f *fetcher, base *url.URL, data []byte, out interface{}) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return newSyntaxError(err)
+	}
+	mapping := documentMapping(&root)
+	if _, ok := out.(*SchemaRelationships); !ok && mapping != nil && isDownload(mapping) {
+		converted, err := convertDownload(data, mapping)
+		if err != nil {
+			return err
+		}
+		return decodeNode(converted, out)
+	}
+	if mapping == nil || !hasReferences(mapping) {
+		return unmarshal(data, out)
+	}
+
+	var chain []*url.URL
+	if base != nil {
+		chain = append(chain, cleanURL(base))
+	}
+	refs, err := resolveReferences(ctx, f, base, mapping, chain)
+	if err != nil {
+		return err
+	}
+
+	// The values of the document and of each reference are decoded apart,
+	// so that errors in a value can be attributed to the file it came from.
+	if err := decodeNode(mapping, out); err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := decodeNode(ref.node, out); err != nil {
+			return &ReferenceError{Reference: ref.Reference, Err: err}
+		}
+		if referrer, ok := ctx.Value(referrerKey{}).(Referrer); ok {
+			referrer.AddReference(ref.Reference)
+		}
+	}
+	return nil
+}
+
+// resolvedReference is a reference along with a mapping holding its value
+// under the key it stands for.
+type resolvedReference struct {
+	Reference
+	node *yaml.Node
+}
+
+// resolveReferences removes the references from the mapping and returns
+// them resolved. The chain holds the documents being resolved, outermost
+// first, to detect documents that reference themselves.
+func resolveReferences(ctx context.Context, f *fetcher, base *url.URL, mapping *yaml.Node, chain []*url.URL) ([]resolvedReference, error) {
+	var refs []resolvedReference
+	var content []*yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keyNode, valueNode := mapping.Content[i], mapping.Content[i+1]
+		key, ok := referenceKeys[keyNode.Value]
+		if !ok {
+			content = append(content, keyNode, valueNode)
+			continue
+		}
+		if mappingValue(mapping, key) != nil {
+			return nil, newSyntaxError(fmt.Errorf("line %d: document sets both %s and %s", keyNode.Line, key, keyNode.Value))
+		}
+		if valueNode.Kind != yaml.ScalarNode || valueNode.Value == "" {
+			return nil, newSyntaxError(fmt.Errorf("line %d: %s must name a file", keyNode.Line, keyNode.Value))
+		}
+
+		ref, err := resolveReference(ctx, f, base, keyNode.Value, valueNode.Value, chain)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	mapping.Content = content
+	return refs, nil
+}
+
+// resolveReference reads the file the key references and returns its value.
+func resolveReference(ctx context.Context, f *fetcher, base *url.URL, key, target string, chain []*url.URL) (resolvedReference, error) {
+	ref := resolvedReference{Reference: Reference{Key: key, Source: target}}
+	u, err := referenceURL(base, target)
+	if err != nil {
+		return ref, &ReferenceError{Reference: ref.Reference, Err: err}
+	}
+	ref.Source = redactedURL(u)
+	for _, source := range chain {
+		if source.String() == u.String() {
+			cycle := make([]string, 0, len(chain)+1)
+			for _, source := range append(chain, u) {
+				cycle = append(cycle, redactedURL(source))
+			}
+			return ref, &ReferenceError{
+				Reference: ref.Reference,
+				Err:       fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> ")),
+			}
+		}
+	}
+
+	data, err := f.read(ctx, u)
+	if err != nil {
+		return ref, &ReferenceError{Reference: ref.Reference, Err: err}
+	}
+	ref.Contents = data
+
+	field := referenceKeys[key]
+	if !isDocument(u.Path) {
+		ref.node = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: field},
+			{Kind: yaml.ScalarNode, Style: yaml.LiteralStyle, Value: string(data), Line: 1, Column: 1},
+		}}
+		return ref, nil
+	}
+
+	// The file is another document: take its value for the same key,
+	// following its own reference if it has one.
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return ref, &ReferenceError{Reference: ref.Reference, Err: newSyntaxError(err)}
+	}
+	mapping := documentMapping(&root)
+	if mapping == nil {
+		return ref, &ReferenceError{Reference: ref.Reference, Err: newSyntaxError(fmt.Errorf("not a validation document"))}
+	}
+	if nested := mappingValue(mapping, key); nested != nil {
+		if nested.Kind != yaml.ScalarNode || nested.Value == "" {
+			return ref, &ReferenceError{Reference: ref.Reference, Err: newSyntaxError(fmt.Errorf("line %d: %s must name a file", nested.Line, key))}
+		}
+		return resolveReference(ctx, f, u, key, nested.Value, append(chain, u))
+	}
+	value := mappingValue(mapping, field)
+	if value == nil {
+		return ref, &ReferenceError{Reference: ref.Reference, Err: fmt.Errorf("document has no %s", field)}
+	}
+	ref.Line = value.Line
+	ref.node = &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: field}, value}}
+	return ref, nil
+}
+
+// referenceURL resolves the target of a reference against the URL of the
+// document holding it. Remote documents may only reference remote files.
+func referenceURL(base *url.URL, target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case base == nil:
+		return cleanURL(u), nil
+	case isRemote(base):
+		u = base.ResolveReference(u)
+		if !isRemote(u) {
+			return nil, fmt.Errorf("a remote document cannot reference %s", u)
+		}
+		return u, nil
+	case u.Scheme != "" || u.Host != "":
+		return cleanURL(u), nil
+	case !path.IsAbs(u.Path):
+		// Local sources may be relative paths, which URL resolution would
+		// make absolute.
+		u.Path = path.Join(path.Dir(base.Path), u.Path)
+	}
+	u.Scheme = base.Scheme
+	return cleanURL(u), nil
+}
+
+// cleanURL returns the URL with the path of a local file cleaned, so that
+// the same file is always named the same way.
+func cleanURL(u *url.URL) *url.URL {
+	if isRemote(u) {
+		return u
+	}
+	return &url.URL{Scheme: u.Scheme, Path: path.Clean(u.Path)}
+}
+
+func isRemote(u *url.URL) bool {
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// documentMapping returns the top-level mapping of a parsed document, or nil
+// if it is not a mapping.
+func documentMapping(root *yaml.Node) *yaml.Node {
+	if root.Kind != yaml.DocumentNode || len(root.Content) != 1 || root.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	return root.Content[0]
+}
+
+func hasReferences(mapping *yaml.Node) bool {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if _, ok := referenceKeys[mapping.Content[i].Value]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mappingValue returns the value of the key in the mapping, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
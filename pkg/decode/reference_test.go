@@ -0,0 +1,138 @@
+package decode
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testDocument struct {
+	Schema        string `yaml:"schema"`
+	Relationships string `yaml:"relationships"`
+	Assertions    string `yaml:"assertions"`
+}
+
+type testReferrer []Reference
+
+func (r *testReferrer) AddReference(ref Reference) {
+	*r = append(*r, ref)
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, contents := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o700))
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0o600))
+	}
+	return filepath.ToSlash(dir)
+}
+
+func TestFileDecoderReferences(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"shared/schema.zed":         "definition user {}\n",
+		"shared/relationships.txt":  "document:plan#viewer@user:alice\n",
+		"shared/base.yaml":          "schema: |-\n  definition base {}\n",
+		"shared/chained.yaml":       "schemaFile: base.yaml\n",
+		"fixtures/plain.yaml":       "schemaFile: ../shared/schema.zed\nrelationshipsFile: ../shared/relationships.txt\nassertions: x\n",
+		"fixtures/document.yaml":    "schemaFile: ../shared/chained.yaml\n",
+		"fixtures/both.yaml":        "schema: definition user {}\nschemaFile: ../shared/schema.zed\n",
+		"fixtures/missing.yaml":     "schemaFile: ../shared/missing.zed\n",
+		"fixtures/missing-key.yaml": "relationshipsFile: ../shared/base.yaml\n",
+		"fixtures/cycle-a.yaml":     "schemaFile: cycle-b.yaml\n",
+		"fixtures/cycle-b.yaml":     "schemaFile: ./cycle-a.yaml\n",
+	})
+
+	decodeFile := func(name string) (testDocument, testReferrer, error) {
+		var out testDocument
+		var refs testReferrer
+		d, err := DecoderForURL(&url.URL{Path: root + "/fixtures/" + name})
+		require.NoError(t, err)
+		_, err = d(WithReferrer(context.Background(), &refs), &out)
+		return out, refs, err
+	}
+
+	out, refs, err := decodeFile("plain.yaml")
+	require.NoError(t, err)
+	require.Equal(t, testDocument{
+		Schema:        "definition user {}\n",
+		Relationships: "document:plan#viewer@user:alice\n",
+		Assertions:    "x",
+	}, out)
+	require.Equal(t, testReferrer{
+		{Key: SchemaFileKey, Source: root + "/shared/schema.zed", Contents: []byte("definition user {}\n")},
+		{Key: RelationshipsFileKey, Source: root + "/shared/relationships.txt", Contents: []byte("document:plan#viewer@user:alice\n")},
+	}, refs)
+
+	out, refs, err = decodeFile("document.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "definition base {}", out.Schema)
+	require.Len(t, refs, 1)
+	require.Equal(t, root+"/shared/base.yaml", refs[0].Source)
+	require.Equal(t, 1, refs[0].Line)
+
+	_, _, err = decodeFile("both.yaml")
+	var syntaxErr *SyntaxError
+	require.ErrorAs(t, err, &syntaxErr)
+	require.ErrorContains(t, err, "document sets both schema and schemaFile")
+
+	_, _, err = decodeFile("missing.yaml")
+	var refErr *ReferenceError
+	require.ErrorAs(t, err, &refErr)
+	require.Equal(t, root+"/shared/missing.zed", refErr.Reference.Source)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, _, err = decodeFile("missing-key.yaml")
+	require.ErrorContains(t, err, "base.yaml: document has no relationships")
+
+	_, _, err = decodeFile("cycle-a.yaml")
+	require.ErrorContains(t, err, "include cycle: "+root+"/fixtures/cycle-a.yaml -> "+root+"/fixtures/cycle-b.yaml -> "+root+"/fixtures/cycle-a.yaml")
+}
+
+func TestHTTPDecoderReferences(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fixtures/document.yaml":
+			_, _ = w.Write([]byte("schemaFile: ../schema.zed\n"))
+		case "/fixtures/local.yaml":
+			_, _ = w.Write([]byte("schemaFile: file:///etc/passwd\n"))
+		case "/schema.zed":
+			_, _ = w.Write([]byte("definition user {}"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	decodeURL := func(path string) (testDocument, error) {
+		u, err := url.Parse(server.URL + path)
+		require.NoError(t, err)
+		d, err := DecoderForURL(u)
+		require.NoError(t, err)
+		var out testDocument
+		_, err = d(context.Background(), &out)
+		return out, err
+	}
+
+	out, err := decodeURL("/fixtures/document.yaml")
+	require.NoError(t, err)
+	require.Equal(t, "definition user {}", out.Schema)
+
+	_, err = decodeURL("/fixtures/local.yaml")
+	require.ErrorContains(t, err, "a remote document cannot reference file:///etc/passwd")
+}
+
+func TestBytesDecoderReferences(t *testing.T) {
+	root := writeFiles(t, map[string]string{"schema.zed": "definition user {}"})
+
+	var out testDocument
+	_, err := BytesDecoder([]byte("schemaFile: "+root+"/schema.zed\n"))(context.Background(), &out)
+	require.NoError(t, err)
+	require.Equal(t, "definition user {}", out.Schema)
+}
@@ -14,34 +14,70 @@ package printers
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
 	"github.com/authzed/spicedb/pkg/tuple"
-	"github.com/gookit/color"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
-// DisplayCheckTrace prints out the check trace found in the given debug message.
-func DisplayCheckTrace(checkTrace *v1.CheckDebugTrace, tp *TreePrinter, hasError bool) {
-	displayCheckTrace(checkTrace, tp, hasError, map[string]struct{}{})
+// DisplayCheckTrace prints out the check trace found in the given debug message,
+// colored with the color profile of r. A nil r prints it without colors.
+func DisplayCheckTrace(checkTrace *v1.CheckDebugTrace, tp *TreePrinter, hasError bool, r *lipgloss.Renderer) {
+	if r == nil {
+		r = lipgloss.NewRenderer(io.Discard)
+		r.SetColorProfile(termenv.Ascii)
+	}
+	displayCheckTrace(checkTrace, tp, hasError, newTraceColors(r), map[string]struct{}{})
 }
 
-func displayCheckTrace(checkTrace *v1.CheckDebugTrace, tp *TreePrinter, hasError bool, encountered map[string]struct{}) {
-	red := color.FgRed.Render
-	green := color.FgGreen.Render
-	cyan := color.FgCyan.Render
-	white := color.FgWhite.Render
-	faint := color.FgGray.Render
-	magenta := color.FgMagenta.Render
+// traceColors are the colors of a check trace, rendered for one output.
+type traceColors struct {
+	red, green, cyan, white, faint, magenta func(...string) string
+	orange, purple, lightgreen, caveat      func(...string) string
 
-	orange := color.C256(166).Sprint
-	purple := color.C256(99).Sprint
-	lightgreen := color.C256(35).Sprint
-	caveatColor := color.C256(198).Sprint
+	// expression is the style of a caveat expression that did not
+	// evaluate to false.
+	expression func(...string) string
+}
+
+func newTraceColors(r *lipgloss.Renderer) traceColors {
+	foreground := func(c string) func(...string) string {
+		return r.NewStyle().Foreground(lipgloss.Color(c)).Render
+	}
+	return traceColors{
+		red:        foreground("1"),
+		green:      foreground("2"),
+		cyan:       foreground("6"),
+		white:      foreground("7"),
+		faint:      foreground("8"),
+		magenta:    foreground("5"),
+		orange:     foreground("166"),
+		purple:     foreground("99"),
+		lightgreen: foreground("35"),
+		caveat:     foreground("198"),
+		expression: r.NewStyle().Foreground(lipgloss.Color("#ffffff")).Italic(true).Render,
+	}
+}
+
+func displayCheckTrace(checkTrace *v1.CheckDebugTrace, tp *TreePrinter, hasError bool, colors traceColors, encountered map[string]struct{}) {
+	red := colors.red
+	green := colors.green
+	cyan := colors.cyan
+	white := colors.white
+	faint := colors.faint
+	magenta := colors.magenta
+
+	orange := colors.orange
+	purple := colors.purple
+	lightgreen := colors.lightgreen
+	caveatColor := colors.caveat
 
 	hasPermission := green("✓")
 	resourceColor := white
-	permissionColor := color.FgWhite.Render
+	permissionColor := white
 
 	if checkTrace.PermissionType == v1.CheckDebugTrace_PERMISSION_TYPE_PERMISSION {
 		permissionColor = lightgreen
@@ -80,7 +116,7 @@ func displayCheckTrace(checkTrace *v1.CheckDebugTrace, tp *TreePrinter, hasError
 		key := cycleKey(checkTrace)
 		_, isEndOfCycle = encountered[key]
 		if isEndOfCycle {
-			additional = color.C256(166).Sprint(" (cycle)")
+			additional = orange(" (cycle)")
 		}
 		encountered[key] = struct{}{}
 	}
@@ -108,7 +144,7 @@ func displayCheckTrace(checkTrace *v1.CheckDebugTrace, tp *TreePrinter, hasError
 
 	if checkTrace.GetCaveatEvaluationInfo() != nil {
 		indicator := ""
-		exprColor := color.FgWhite.Render
+		exprColor := colors.expression
 		switch checkTrace.CaveatEvaluationInfo.Result {
 		case v1.CaveatEvalInfo_RESULT_FALSE:
 			indicator = red("⨉")
@@ -121,9 +157,6 @@ func displayCheckTrace(checkTrace *v1.CheckDebugTrace, tp *TreePrinter, hasError
 			indicator = magenta("?")
 		}
 
-		white := color.HEXStyle("fff")
-		white.SetOpts(color.Opts{color.OpItalic})
-
 		contextMap := checkTrace.CaveatEvaluationInfo.Context.AsMap()
 		caveatName := checkTrace.CaveatEvaluationInfo.CaveatName
 
@@ -144,7 +177,7 @@ func displayCheckTrace(checkTrace *v1.CheckDebugTrace, tp *TreePrinter, hasError
 
 	if checkTrace.GetSubProblems() != nil {
 		for _, subProblem := range checkTrace.GetSubProblems().Traces {
-			displayCheckTrace(subProblem, tp, hasError, encountered)
+			displayCheckTrace(subProblem, tp, hasError, colors, encountered)
 		}
 	} else if checkTrace.Result == v1.CheckDebugTrace_PERMISSIONSHIP_HAS_PERMISSION {
 		tp.Child(purple(fmt.Sprintf("%s:%s %s", checkTrace.Subject.Object.ObjectType, checkTrace.Subject.Object.ObjectId, checkTrace.Subject.OptionalRelation)))
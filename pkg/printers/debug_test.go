@@ -0,0 +1,57 @@
+// Copyright 2023 Authzed, Inc.
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//        http://www.apache.org/licenses/LICENSE-2.0
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package printers
+
+import (
+	"io"
+	"testing"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestDisplayCheckTraceCaveatExpression(t *testing.T) {
+	trace := func(result v1.CaveatEvalInfo_Result) *v1.CheckDebugTrace {
+		return &v1.CheckDebugTrace{
+			Resource:   &v1.ObjectReference{ObjectType: "document", ObjectId: "plan"},
+			Permission: "view",
+			Subject:    &v1.SubjectReference{Object: &v1.ObjectReference{ObjectType: "user", ObjectId: "bob"}},
+			Result:     v1.CheckDebugTrace_PERMISSIONSHIP_CONDITIONAL_PERMISSION,
+			CaveatEvaluationInfo: &v1.CaveatEvalInfo{
+				Expression: "network == \"office\"",
+				Result:     result,
+				Context:    &structpb.Struct{},
+				CaveatName: "on_network",
+			},
+		}
+	}
+
+	r := lipgloss.NewRenderer(io.Discard)
+	r.SetColorProfile(termenv.TrueColor)
+	italic := r.NewStyle().Foreground(lipgloss.Color("#ffffff")).Italic(true).Render(`network == "office"`)
+
+	tp := NewTreePrinter()
+	DisplayCheckTrace(trace(v1.CaveatEvalInfo_RESULT_TRUE), tp, false, r)
+	require.Contains(t, tp.String(), italic)
+
+	tp = NewTreePrinter()
+	DisplayCheckTrace(trace(v1.CaveatEvalInfo_RESULT_FALSE), tp, false, r)
+	require.NotContains(t, tp.String(), italic)
+
+	tp = NewTreePrinter()
+	DisplayCheckTrace(trace(v1.CaveatEvalInfo_RESULT_TRUE), tp, false, nil)
+	require.Contains(t, tp.String(), `network == "office"`)
+	require.NotContains(t, tp.String(), "\x1b[")
+}
@@ -35,8 +35,9 @@ func prettySubject(subj *v1.SubjectReference) string {
 }
 
 // TreeNodeTree walks an Authzed Tree Node and creates corresponding nodes
-// for a treeprinter.
-func TreeNodeTree(tp *TreePrinter, treeNode *v1.PermissionRelationshipTree) {
+// for a treeprinter. It returns an error if the tree contains an operation or
+// node type it does not know how to print.
+func TreeNodeTree(tp *TreePrinter, treeNode *v1.PermissionRelationshipTree) error {
 	if treeNode.ExpandedObject != nil {
 		tp = tp.Child(fmt.Sprintf(
 			"%s:%s->%s",
@@ -47,30 +48,29 @@ func TreeNodeTree(tp *TreePrinter, treeNode *v1.PermissionRelationshipTree) {
 	}
 	switch typed := treeNode.TreeType.(type) {
 	case *v1.PermissionRelationshipTree_Intermediate:
+		var operation string
 		switch typed.Intermediate.Operation {
 		case v1.AlgebraicSubjectSet_OPERATION_UNION:
-			union := tp.Child("union")
-			for _, child := range typed.Intermediate.Children {
-				TreeNodeTree(union, child)
-			}
+			operation = "union"
 		case v1.AlgebraicSubjectSet_OPERATION_INTERSECTION:
-			intersection := tp.Child("intersection")
-			for _, child := range typed.Intermediate.Children {
-				TreeNodeTree(intersection, child)
-			}
+			operation = "intersection"
 		case v1.AlgebraicSubjectSet_OPERATION_EXCLUSION:
-			exclusion := tp.Child("exclusion")
-			for _, child := range typed.Intermediate.Children {
-				TreeNodeTree(exclusion, child)
-			}
+			operation = "exclusion"
 		default:
-			panic("unknown expand operation")
+			return fmt.Errorf("unknown expand operation %s", typed.Intermediate.Operation)
+		}
+		operationNode := tp.Child(operation)
+		for _, child := range typed.Intermediate.Children {
+			if err := TreeNodeTree(operationNode, child); err != nil {
+				return err
+			}
 		}
 	case *v1.PermissionRelationshipTree_Leaf:
 		for _, subject := range typed.Leaf.Subjects {
 			tp.Child(prettySubject(subject))
 		}
 	default:
-		panic("unknown TreeNode type")
+		return fmt.Errorf("unknown TreeNode type %T", treeNode.TreeType)
 	}
+	return nil
 }
@@ -0,0 +1,48 @@
+// Copyright 2023 Authzed, Inc.
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//        http://www.apache.org/licenses/LICENSE-2.0
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package printers
+
+import (
+	"testing"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTreeNodeTree(t *testing.T) {
+	tree := &v1.PermissionRelationshipTree{
+		ExpandedObject:   &v1.ObjectReference{ObjectType: "document", ObjectId: "plan"},
+		ExpandedRelation: "view",
+		TreeType: &v1.PermissionRelationshipTree_Intermediate{
+			Intermediate: &v1.AlgebraicSubjectSet{
+				Operation: v1.AlgebraicSubjectSet_OPERATION_UNION,
+				Children: []*v1.PermissionRelationshipTree{{
+					TreeType: &v1.PermissionRelationshipTree_Leaf{
+						Leaf: &v1.DirectSubjectSet{Subjects: []*v1.SubjectReference{
+							{Object: &v1.ObjectReference{ObjectType: "user", ObjectId: "alice"}},
+							{Object: &v1.ObjectReference{ObjectType: "group", ObjectId: "eng"}, OptionalRelation: "member"},
+						}},
+					},
+				}},
+			},
+		},
+	}
+
+	tp := NewTreePrinter()
+	require.NoError(t, TreeNodeTree(tp, tree))
+	require.Equal(t, "document:plan->view\n└── union\n    ├── user:alice\n    └── group:eng->member\n", tp.String())
+
+	tree.GetIntermediate().Operation = v1.AlgebraicSubjectSet_OPERATION_UNSPECIFIED
+	require.Error(t, TreeNodeTree(NewTreePrinter(), tree))
+
+	require.Error(t, TreeNodeTree(NewTreePrinter(), &v1.PermissionRelationshipTree{}))
+}
@@ -12,6 +12,8 @@
 package printers
 
 import (
+	"fmt"
+	"io"
 	"strings"
 
 	"github.com/leetrout/python-spicedb-validation/pkg/console"
@@ -39,13 +41,28 @@ func (tp *TreePrinter) Print() {
 }
 
 func (tp *TreePrinter) PrintIndented() {
+	console.Println(tp.indented())
+}
+
+// Fprint writes the tree to w rather than to the console.
+func (tp *TreePrinter) Fprint(w io.Writer) error {
+	_, err := fmt.Fprintln(w, tp.String())
+	return err
+}
+
+// FprintIndented writes the indented tree to w rather than to the console.
+func (tp *TreePrinter) FprintIndented(w io.Writer) error {
+	_, err := fmt.Fprintln(w, tp.indented())
+	return err
+}
+
+func (tp *TreePrinter) indented() string {
 	lines := strings.Split(tp.String(), "\n")
 	indentedLines := make([]string, 0, len(lines))
 	for _, line := range lines {
 		indentedLines = append(indentedLines, "  "+line)
 	}
-
-	console.Println(strings.Join(indentedLines, "\n"))
+	return strings.Join(indentedLines, "\n")
 }
 
 func (tp *TreePrinter) String() string {
@@ -12,6 +12,7 @@
 package printers
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -29,3 +30,17 @@ func TestTreePrinter(t *testing.T) {
 	tp.Child("child2")
 	require.Equal(t, "parent\n├── child1\n│   └── grandchild\n└── child2\n", tp.String())
 }
+
+func TestTreePrinterFprint(t *testing.T) {
+	tp := NewTreePrinter()
+	tp = tp.Child("parent")
+	tp.Child("child")
+
+	var out strings.Builder
+	require.NoError(t, tp.Fprint(&out))
+	require.Equal(t, "parent\n└── child\n\n", out.String())
+
+	out.Reset()
+	require.NoError(t, tp.FprintIndented(&out))
+	require.Equal(t, "  parent\n  └── child\n  \n", out.String())
+}
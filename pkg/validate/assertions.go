@@ -0,0 +1,205 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/authzed/spicedb/pkg/development"
+	devinterface "github.com/authzed/spicedb/pkg/proto/developer/v1"
+	v1dispatch "github.com/authzed/spicedb/pkg/proto/dispatch/v1"
+	"github.com/authzed/spicedb/pkg/tuple"
+	"github.com/authzed/spicedb/pkg/validationfile/blocks"
+)
+
+// AssertionKind is the block of the document an assertion is listed in.
+type AssertionKind string
+
+const (
+	AssertTrue     AssertionKind = "assertTrue"
+	AssertCaveated AssertionKind = "assertCaveated"
+	AssertFalse    AssertionKind = "assertFalse"
+)
+
+// AssertionResult is the outcome of a single assertion.
+type AssertionResult struct {
+	Kind AssertionKind `json:"kind"`
+
+	// Relationship is the assertion as written, including any caveat
+	// context.
+	Relationship string `json:"relationship"`
+
+	// Line and Column are 1-indexed, or zero when unknown.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+
+	Passed bool `json:"passed"`
+
+	// Skipped is set when the assertion was not run because its outcome
+	// depends on a relationship dropped with Options.KeepGoing.
+	Skipped bool `json:"skipped,omitempty"`
+
+	// Permissionship is the outcome of the check, in the form of
+	// CheckResult.Permissionship, or empty if the check could not be run.
+	Permissionship string `json:"permissionship,omitempty"`
+
+	// Context is the caveat context given with the assertion, if any.
+	Context map[string]any `json:"context,omitempty"`
+
+	// MissingContext lists the caveat parameters that were required but not
+	// supplied, for conditional results.
+	MissingContext []string `json:"missingContext,omitempty"`
+
+	// Caveats are the caveats evaluated by the check.
+	Caveats []CaveatEvaluation `json:"caveats,omitempty"`
+
+	// Message describes why the assertion failed.
+	Message string `json:"message,omitempty"`
+
+	// DurationMs is how long the check took, in milliseconds.
+	DurationMs float64 `json:"durationMs"`
+
+	// Trace and TraceText are the check trace of a failed assertion, in the
+	// form of CheckResult.Trace and CheckResult.TraceText.
+	Trace     json.RawMessage `json:"trace,omitempty"`
+	TraceText string          `json:"traceText,omitempty"`
+}
+
+// Caveated reports whether the assertion involves caveats: it is listed in
+// assertCaveated, gives a caveat context or evaluated a caveat.
+func (a AssertionResult) Caveated() bool {
+	return a.Kind == AssertCaveated || a.Context != nil || len(a.Caveats) > 0
+}
+
+// assertionBlock is a block of assertions, with the membership each of them
+// expects and the message reported when it does not hold.
+type assertionBlock struct {
+	kind       AssertionKind
+	assertions []blocks.Assertion
+	expected   v1dispatch.ResourceCheckResult_Membership
+	message    string
+}
+
+// runAssertions runs every assertion of the document in the order of
+// development.RunAllAssertions, returning the outcome of each and the
+// developer errors that function would have returned. Assertions affected by
+// a dropped relationship are skipped.
+func runAssertions(devCtx *development.DevContext, assertions *blocks.Assertions, dropped droppedRelationships) ([]AssertionResult, []*devinterface.DeveloperError, error) {
+	assertionBlocks := []assertionBlock{
+		{AssertTrue, assertions.AssertTrue, v1dispatch.ResourceCheckResult_MEMBER, "Expected relation or permission %s to exist"},
+		{AssertCaveated, assertions.AssertCaveated, v1dispatch.ResourceCheckResult_CAVEATED_MEMBER, "Expected relation or permission %s to be caveated"},
+		{AssertFalse, assertions.AssertFalse, v1dispatch.ResourceCheckResult_NOT_MEMBER, "Expected relation or permission %s to not exist"},
+	}
+
+	results := []AssertionResult{}
+	var failures []*devinterface.DeveloperError
+	for _, block := range assertionBlocks {
+		for _, assertion := range block.assertions {
+			result, devErr, err := runAssertion(devCtx, block, assertion, dropped)
+			if err != nil {
+				return nil, nil, err
+			}
+			results = append(results, result)
+			if devErr != nil {
+				failures = append(failures, devErr)
+			}
+		}
+	}
+	return results, failures, nil
+}
+
+func runAssertion(devCtx *development.DevContext, block assertionBlock, assertion blocks.Assertion, dropped droppedRelationships) (AssertionResult, *devinterface.DeveloperError, error) {
+	result := AssertionResult{
+		Kind:         block.kind,
+		Relationship: assertion.RelationshipWithContextString,
+		Line:         assertion.SourcePosition.LineNumber,
+		Column:       assertion.SourcePosition.ColumnPosition,
+		Context:      assertion.CaveatContext,
+	}
+	line := uint32(assertion.SourcePosition.LineNumber)
+	column := uint32(assertion.SourcePosition.ColumnPosition)
+
+	if err := assertion.Relationship.Validate(); err != nil {
+		devErr := &devinterface.DeveloperError{
+			Message: fmt.Sprintf("invalid assertion relationship `%s`: %s", assertion.RelationshipWithContextString, err),
+			Source:  devinterface.DeveloperError_ASSERTION,
+			Kind:    devinterface.DeveloperError_PARSE_ERROR,
+			Context: assertion.RelationshipWithContextString,
+			Line:    line,
+			Column:  column,
+		}
+		result.Message = devErr.Message
+		return result, devErr, nil
+	}
+
+	tpl := tuple.FromRelationship[*v1.ObjectReference, *v1.SubjectReference, *v1.ContextualizedCaveat](assertion.Relationship)
+	if tpl.Caveat != nil {
+		devErr := &devinterface.DeveloperError{
+			Message: fmt.Sprintf("cannot specify a caveat on an assertion: `%s`", assertion.RelationshipWithContextString),
+			Source:  devinterface.DeveloperError_ASSERTION,
+			Kind:    devinterface.DeveloperError_UNKNOWN_RELATION,
+			Context: assertion.RelationshipWithContextString,
+			Line:    line,
+			Column:  column,
+		}
+		result.Message = devErr.Message
+		return result, devErr, nil
+	}
+
+	if relString, ok := dropped.affecting(devCtx.CompiledSchema, tpl.ResourceAndRelation); ok {
+		result.Skipped = true
+		result.Message = fmt.Sprintf("skipped: depends on invalid relationship `%s`", relString)
+		return result, nil, nil
+	}
+
+	start := time.Now()
+	cr, err := development.RunCheck(devCtx, tpl.ResourceAndRelation, tpl.Subject, assertion.CaveatContext)
+	result.DurationMs = float64(time.Since(start)) / float64(time.Millisecond)
+	if err != nil {
+		devErr, wireErr := development.DistinguishGraphError(
+			devCtx,
+			err,
+			devinterface.DeveloperError_ASSERTION,
+			line,
+			column,
+			assertion.RelationshipWithContextString,
+		)
+		if wireErr != nil {
+			return result, nil, wireErr
+		}
+		if devErr != nil {
+			result.Message = devErr.Message
+		}
+		return result, devErr, nil
+	}
+
+	result.Permissionship = permissionshipString(cr.Permissionship)
+	result.MissingContext = cr.MissingCaveatFields
+	if cr.V1DebugInfo != nil {
+		result.Caveats = caveatEvaluations(cr.V1DebugInfo.Check)
+	}
+	if cr.Permissionship == block.expected {
+		result.Passed = true
+		return result, nil, nil
+	}
+
+	devErr := &devinterface.DeveloperError{
+		Message:                       fmt.Sprintf(block.message, assertion.RelationshipWithContextString),
+		Source:                        devinterface.DeveloperError_ASSERTION,
+		Kind:                          devinterface.DeveloperError_ASSERTION_FAILED,
+		Context:                       assertion.RelationshipWithContextString,
+		Line:                          line,
+		Column:                        column,
+		CheckDebugInformation:         cr.DispatchDebugInfo,
+		CheckResolvedDebugInformation: cr.V1DebugInfo,
+	}
+	result.Message = devErr.Message
+	if cr.V1DebugInfo != nil && cr.V1DebugInfo.Check != nil {
+		result.Trace, result.TraceText, err = encodeCheckTrace(cr.V1DebugInfo.Check)
+		if err != nil {
+			return result, nil, err
+		}
+	}
+	return result, devErr, nil
+}
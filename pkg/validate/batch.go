@@ -0,0 +1,211 @@
+package validate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+)
+
+// BatchResult is the outcome of validating many documents.
+type BatchResult struct {
+	// Status is StatusError if any document could not be validated,
+	// StatusFailure if any has errors, and StatusSuccess otherwise.
+	Status Status `json:"status"`
+
+	// Sources lists the source of each document, in the order they were
+	// listed, with directories and glob patterns expanded. Where documents
+	// given as contents share a source, later ones get a suffix such as "[2]".
+	Sources []string `json:"sources"`
+
+	// Results holds the result of each document, keyed by its entry in
+	// Sources.
+	Results map[string]*Result `json:"results"`
+
+	Summary BatchSummary `json:"summary"`
+}
+
+// BatchSummary totals the results of a batch.
+type BatchSummary struct {
+	Documents int `json:"documents"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Errored   int `json:"errored"`
+
+	RelationshipsLoaded        int `json:"relationshipsLoaded"`
+	AssertionsRun              int `json:"assertionsRun"`
+	CaveatedAssertionsRun      int `json:"caveatedAssertionsRun"`
+	ExpectedRelationsValidated int `json:"expectedRelationsValidated"`
+	Errors                     int `json:"errors"`
+
+	// DurationMs is how long the whole batch took, in milliseconds.
+	DurationMs float64 `json:"durationMs"`
+}
+
+// ValidateBatch validates the documents described by each of the options,
+// running up to workers of them at a time; zero or less runs one per CPU.
+// Documents fetched from a URL or path are identified by their Source, and
+// one listed more than once is validated once; documents given as Contents
+// are always validated. Sources naming a directory or a glob pattern are
+// expanded into the documents they name, as by decode.ExpandURL.
+//
+// Each document whose options set Output has its rendering written there
+// once the whole batch is done, in the order the documents were listed. The
+// returned error is the first error writing one of them.
+func ValidateBatch(ctx context.Context, docs []Options, workers int) (*BatchResult, error) {
+	start := time.Now()
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	fetched := map[string]bool{}
+	keys := map[string]bool{}
+	var unique []Options
+	var sources []string
+	var results []*Result
+	for _, opts := range docs {
+		expanded, err := expandSource(opts)
+		if err != nil {
+			expanded = []Options{opts}
+		}
+		for _, opts := range expanded {
+			if isFetched(opts) {
+				if fetched[opts.Source] {
+					continue
+				}
+				fetched[opts.Source] = true
+			}
+			key := opts.Source
+			for n := 2; keys[key]; n++ {
+				key = fmt.Sprintf("%s[%d]", opts.Source, n)
+			}
+			keys[key] = true
+			unique = append(unique, opts)
+			sources = append(sources, key)
+
+			// Sources that cannot be expanded are reported without being
+			// validated.
+			var result *Result
+			if err != nil {
+				result = NewResult(opts.Source).failPhase(PhaseParse, categorized(CategoryDecode, err))
+			}
+			results = append(results, result)
+		}
+	}
+
+	outputs := make([]bytes.Buffer, len(unique))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(unique)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				opts := unique[j]
+				if opts.Output != nil {
+					opts.Output = &outputs[j]
+				}
+				results[j] = validateRecovering(ctx, opts)
+			}
+		}()
+	}
+	for j := range unique {
+		if results[j] == nil {
+			jobs <- j
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	batch := &BatchResult{Status: StatusSuccess, Sources: []string{}, Results: make(map[string]*Result, len(unique))}
+	var outputErr error
+	for j, result := range results {
+		batch.add(sources[j], result)
+		if output := unique[j].Output; output != nil {
+			if _, err := output.Write(outputs[j].Bytes()); err != nil && outputErr == nil {
+				outputErr = err
+			}
+		}
+	}
+	batch.Summary.DurationMs = float64(time.Since(start)) / float64(time.Millisecond)
+	return batch, outputErr
+}
+
+// validateRecovering validates a document of a batch, turning a panic into
+// an internal error result: it runs on a goroutine of the batch, where no
+// recover of the caller can catch it.
+func validateRecovering(ctx context.Context, opts Options) (result *Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = NewResult(opts.Source).Fail(categorized(CategoryInternal, fmt.Errorf("panic: %v", r)))
+			result.Stack = string(debug.Stack())
+		}
+	}()
+	result, _ = Validate(ctx, opts)
+	return result
+}
+
+// isFetched reports whether the document is read from its source, rather
+// than given by the options.
+func isFetched(opts Options) bool {
+	return opts.Contents == nil && opts.Decoder == nil
+}
+
+// expandSource returns the options of each document the source of the
+// options names, or the options themselves if they name a single document.
+func expandSource(opts Options) ([]Options, error) {
+	if !isFetched(opts) {
+		return []Options{opts}, nil
+	}
+
+	u, err := url.Parse(opts.Source)
+	if err != nil {
+		// Left for Validate to report.
+		return []Options{opts}, nil
+	}
+	urls, err := decode.ExpandURL(u)
+	if err != nil {
+		return nil, err
+	}
+	if len(urls) == 1 && urls[0] == u {
+		return []Options{opts}, nil
+	}
+
+	expanded := make([]Options, len(urls))
+	for i, u := range urls {
+		expanded[i] = opts
+		expanded[i].Source = u.String()
+	}
+	return expanded, nil
+}
+
+func (b *BatchResult) add(source string, result *Result) {
+	b.Sources = append(b.Sources, source)
+	b.Results[source] = result
+
+	summary := &b.Summary
+	summary.Documents++
+	switch result.Status {
+	case StatusSuccess:
+		summary.Succeeded++
+	case StatusFailure:
+		summary.Failed++
+		if b.Status == StatusSuccess {
+			b.Status = StatusFailure
+		}
+	default:
+		summary.Errored++
+		b.Status = StatusError
+	}
+	summary.RelationshipsLoaded += result.RelationshipsLoaded
+	summary.AssertionsRun += result.AssertionsRun
+	summary.CaveatedAssertionsRun += result.CaveatedAssertionsRun
+	summary.ExpectedRelationsValidated += result.ExpectedRelationsValidated
+	summary.Errors += len(result.Errors)
+}
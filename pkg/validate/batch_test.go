@@ -0,0 +1,127 @@
+package validate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBatch(t *testing.T) {
+	dir := t.TempDir()
+	var docs []Options
+	for i := 0; i < 8; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("valid-%d.yaml", i))
+		require.NoError(t, os.WriteFile(path, []byte(testDocument), 0o600))
+		docs = append(docs, Options{Source: path})
+	}
+	docs = append(docs,
+		Options{Source: "failing.yaml", Contents: []byte(testFailingDocument)},
+		Options{Source: filepath.Join(dir, "missing.yaml")},
+		Options{Source: docs[0].Source},
+	)
+
+	batch, err := ValidateBatch(context.Background(), docs, 3)
+	require.NoError(t, err)
+	require.Equal(t, StatusError, batch.Status)
+	require.Len(t, batch.Results, 10)
+	require.Equal(t, StatusSuccess, batch.Results[docs[0].Source].Status)
+	require.Equal(t, StatusFailure, batch.Results["failing.yaml"].Status)
+	require.Equal(t, StatusError, batch.Results[docs[9].Source].Status)
+
+	summary := batch.Summary
+	require.Equal(t, 10, summary.Documents)
+	require.Equal(t, 8, summary.Succeeded)
+	require.Equal(t, 1, summary.Failed)
+	require.Equal(t, 1, summary.Errored)
+	require.Equal(t, 8*2+1, summary.RelationshipsLoaded)
+	require.Equal(t, 8*2+1, summary.AssertionsRun)
+	require.Equal(t, 3, summary.Errors)
+	require.Positive(t, summary.DurationMs)
+
+	batch, err = ValidateBatch(context.Background(), docs[:8], 0)
+	require.NoError(t, err)
+	require.Equal(t, StatusSuccess, batch.Status)
+}
+
+func TestValidateBatchContents(t *testing.T) {
+	docs := []Options{
+		{Contents: []byte(testDocument)},
+		{Contents: []byte(testFailingDocument)},
+		{Source: "caveated.yaml", Contents: []byte(testCaveatedDocument)},
+		{Source: "caveated.yaml", Contents: []byte(testCaveatedDocument)},
+	}
+
+	batch, err := ValidateBatch(context.Background(), docs, 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"", "[2]", "caveated.yaml", "caveated.yaml[2]"}, batch.Sources)
+	require.Equal(t, StatusSuccess, batch.Results[""].Status)
+	require.Equal(t, StatusFailure, batch.Results["[2]"].Status)
+	require.Equal(t, "caveated.yaml", batch.Results["caveated.yaml[2]"].File)
+
+	summary := batch.Summary
+	require.Equal(t, 4, summary.Documents)
+	require.Equal(t, 2+1+3+3, summary.AssertionsRun)
+	require.Equal(t, 2+2, summary.CaveatedAssertionsRun)
+}
+
+func TestValidateBatchPanic(t *testing.T) {
+	docs := []Options{
+		{Source: "panics.yaml", Decoder: func(context.Context, interface{}) ([]byte, error) {
+			panic("boom")
+		}},
+		{Source: "valid.yaml", Contents: []byte(testDocument)},
+	}
+
+	batch, err := ValidateBatch(context.Background(), docs, 2)
+	require.NoError(t, err)
+	require.Equal(t, StatusError, batch.Status)
+	require.Equal(t, StatusSuccess, batch.Results["valid.yaml"].Status)
+
+	panicked := batch.Results["panics.yaml"]
+	require.Equal(t, StatusError, panicked.Status)
+	require.Equal(t, CategoryInternal, panicked.Category)
+	require.Equal(t, "panic: boom", panicked.Error)
+	require.Contains(t, panicked.Stack, "validateRecovering")
+}
+
+func TestValidateBatchOutputOrder(t *testing.T) {
+	var out bytes.Buffer
+	docs := []Options{
+		{Source: "failing.yaml", Contents: []byte(testFailingDocument), Output: &out, Color: ColorNever},
+		{Source: "valid.yaml", Contents: []byte(testDocument), Output: &out, Color: ColorNever},
+	}
+
+	_, err := ValidateBatch(context.Background(), docs, 2)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(out.String(), "error: "), out.String())
+	require.True(t, strings.HasSuffix(out.String(), "\nSuccess! - 2 relationships loaded, 2 assertions run, 1 expected relations validated\n"), out.String())
+}
+
+func TestValidateBatchDirectory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "nested"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "valid.yaml"), []byte(testDocument), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "failing.yaml"), []byte(testFailingDocument), 0o600))
+	root := filepath.ToSlash(dir)
+
+	batch, err := ValidateBatch(context.Background(), []Options{{Source: root}, {Source: root + "/**/*.yaml"}}, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{root + "/nested/failing.yaml", root + "/valid.yaml"}, batch.Sources)
+	require.Equal(t, StatusFailure, batch.Status)
+	require.Equal(t, StatusSuccess, batch.Results[root+"/valid.yaml"].Status)
+	require.Equal(t, StatusFailure, batch.Results[root+"/nested/failing.yaml"].Status)
+
+	batch, err = ValidateBatch(context.Background(), []Options{{Source: root + "/*.json"}}, 0)
+	require.NoError(t, err)
+	require.Equal(t, StatusError, batch.Status)
+	require.Equal(t, CategoryDecode, batch.Results[root+"/*.json"].Category)
+
+	_, err = Validate(context.Background(), Options{Source: root})
+	require.ErrorContains(t, err, "names several documents")
+}
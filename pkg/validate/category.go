@@ -0,0 +1,174 @@
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	devinterface "github.com/authzed/spicedb/pkg/proto/developer/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Category classifies a failure. The numeric codes and names are stable and
+// are what callers across the C boundary match on.
+type Category int
+
+const (
+	// CategoryNone means there was no failure.
+	CategoryNone Category = 0
+
+	// CategoryDecode means the document could not be fetched or read.
+	CategoryDecode Category = 1
+
+	// CategoryYAMLSyntax means the document is not valid YAML, or does not
+	// have the shape of a validation document.
+	CategoryYAMLSyntax Category = 2
+
+	// CategorySchema means the schema does not compile.
+	CategorySchema Category = 3
+
+	// CategoryRelationship means a relationship is malformed or does not
+	// fit the schema.
+	CategoryRelationship Category = 4
+
+	// CategoryAssertion means an assertion does not hold, or is malformed.
+	CategoryAssertion Category = 5
+
+	// CategoryExpectedRelations means the expected relations do not match
+	// the computed ones, or are malformed.
+	CategoryExpectedRelations Category = 6
+
+	// CategoryInvalidArgument means an operation was called with invalid
+	// arguments, such as a malformed subject or a closed document.
+	CategoryInvalidArgument Category = 7
+
+	// CategoryCanceled means the call was canceled or timed out.
+	CategoryCanceled Category = 8
+
+	// CategoryInternal means anything else went wrong.
+	CategoryInternal Category = 9
+)
+
+var categoryNames = map[Category]string{
+	CategoryNone:              "none",
+	CategoryDecode:            "decode_error",
+	CategoryYAMLSyntax:        "yaml_syntax_error",
+	CategorySchema:            "schema_error",
+	CategoryRelationship:      "relationship_error",
+	CategoryAssertion:         "assertion_failure",
+	CategoryExpectedRelations: "expected_relations_mismatch",
+	CategoryInvalidArgument:   "invalid_argument",
+	CategoryCanceled:          "canceled",
+	CategoryInternal:          "internal_error",
+}
+
+// String returns the stable name of the category.
+func (c Category) String() string {
+	if name, ok := categoryNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("category(%d)", int(c))
+}
+
+// categoryJSON is the JSON form of a category, carrying both codes.
+type categoryJSON struct {
+	Code int    `json:"code"`
+	Name string `json:"name"`
+}
+
+func (c Category) MarshalJSON() ([]byte, error) {
+	return json.Marshal(categoryJSON{Code: int(c), Name: c.String()})
+}
+
+func (c *Category) UnmarshalJSON(data []byte) error {
+	var parsed categoryJSON
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	*c = Category(parsed.Code)
+	return nil
+}
+
+// Error is an error with a category.
+type Error struct {
+	Category Category
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func categorized(category Category, err error) error {
+	return &Error{Category: category, Err: err}
+}
+
+// notFoundNamespace and notFoundRelation are implemented by the errors
+// spicedb returns when an operation names a definition or relation that is
+// not in the schema.
+type (
+	notFoundNamespace interface{ NotFoundNamespaceName() string }
+	notFoundRelation  interface{ NotFoundRelationName() string }
+)
+
+// CategoryOf classifies an error. Errors that were not classified where they
+// arose are internal errors, unless they come from cancellation or carry a
+// gRPC status saying otherwise.
+func CategoryOf(err error) Category {
+	if err == nil {
+		return CategoryNone
+	}
+
+	var (
+		categorizedErr *Error
+		namespaceErr   notFoundNamespace
+		relationErr    notFoundRelation
+	)
+	switch {
+	case errors.As(err, &categorizedErr):
+		return categorizedErr.Category
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return CategoryCanceled
+	case errors.Is(err, ErrClosed), errors.As(err, &namespaceErr), errors.As(err, &relationErr):
+		return CategoryInvalidArgument
+	}
+
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded:
+		return CategoryCanceled
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.NotFound:
+		return CategoryInvalidArgument
+	default:
+		return CategoryInternal
+	}
+}
+
+// developerErrorCategory classifies an error reported by the development
+// package, from its kind where that is specific and its source otherwise.
+func developerErrorCategory(devErr *devinterface.DeveloperError) Category {
+	switch devErr.Kind {
+	case devinterface.DeveloperError_ASSERTION_FAILED:
+		return CategoryAssertion
+	case devinterface.DeveloperError_MISSING_EXPECTED_RELATIONSHIP, devinterface.DeveloperError_EXTRA_RELATIONSHIP_FOUND:
+		return CategoryExpectedRelations
+	}
+
+	switch devErr.Source {
+	case devinterface.DeveloperError_SCHEMA:
+		return CategorySchema
+	case devinterface.DeveloperError_RELATIONSHIP:
+		return CategoryRelationship
+	case devinterface.DeveloperError_ASSERTION:
+		return CategoryAssertion
+	case devinterface.DeveloperError_VALIDATION_YAML:
+		return CategoryExpectedRelations
+	default:
+		return CategoryInternal
+	}
+}
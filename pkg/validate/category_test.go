@@ -0,0 +1,136 @@
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateCategories(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		contents string
+		want     Category
+	}{
+		{
+			name:     "success",
+			contents: testDocument,
+			want:     CategoryNone,
+		},
+		{
+			name:     "yaml syntax with source",
+			contents: "schema: |-\n  definition user {\n",
+			want:     CategoryYAMLSyntax,
+		},
+		{
+			name:     "yaml syntax",
+			contents: "schema: [\n",
+			want:     CategoryYAMLSyntax,
+		},
+		{
+			name:     "schema",
+			contents: "schema: |-\n  definition user {\n    relation viewer: group\n  }\n",
+			want:     CategorySchema,
+		},
+		{
+			name:     "relationship",
+			contents: "schema: |-\n  definition user {}\nrelationships: |-\n  user:alice#viewer@user:bob\n",
+			want:     CategoryRelationship,
+		},
+		{
+			name:     "assertion",
+			contents: testFailingDocument,
+			want:     CategoryAssertion,
+		},
+		{
+			name:     "expected relations",
+			contents: testDocument[:len(testDocument)-len("    - \"[user:bob] is <document:plan#editor>\"\n")],
+			want:     CategoryExpectedRelations,
+		},
+		{
+			name:   "decode",
+			source: "ftp://example.com/doc.yaml",
+			want:   CategoryDecode,
+		},
+		{
+			name:   "missing file",
+			source: filepath.Join(t.TempDir(), "missing.yaml"),
+			want:   CategoryDecode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Source: tt.source}
+			if tt.contents != "" {
+				opts.Source = "test.yaml"
+				opts.Contents = []byte(tt.contents)
+			}
+
+			result, err := Validate(context.Background(), opts)
+			require.Equal(t, tt.want, result.Category, result.Errors)
+			if err != nil {
+				require.Equal(t, tt.want, CategoryOf(err))
+			}
+			for _, diag := range result.Errors {
+				require.NotEqual(t, CategoryNone, diag.Category)
+			}
+		})
+	}
+}
+
+func TestOperationCategories(t *testing.T) {
+	doc, result := Load(context.Background(), Options{Source: "test.yaml", Contents: []byte(testDocument)})
+	require.NotNil(t, doc, result.Errors)
+
+	_, err := doc.Check(context.Background(), "document", "view", "user:alice", nil)
+	require.Equal(t, CategoryInvalidArgument, CategoryOf(err))
+
+	_, err = doc.Check(context.Background(), "folder:plan", "view", "user:alice", nil)
+	require.Equal(t, CategoryInvalidArgument, CategoryOf(err))
+
+	_, err = doc.LookupResources(context.Background(), "folder", "view", "user:alice", nil)
+	require.Equal(t, CategoryInvalidArgument, CategoryOf(err))
+
+	_, err = ParseCaveatContext("{")
+	require.Equal(t, CategoryInvalidArgument, CategoryOf(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = doc.Check(ctx, "document:plan", "view", "user:alice", nil)
+	require.Equal(t, CategoryCanceled, CategoryOf(err))
+
+	doc.Close()
+	_, err = doc.Check(context.Background(), "document:plan", "view", "user:alice", nil)
+	require.Equal(t, CategoryInvalidArgument, CategoryOf(err))
+}
+
+func TestCategoryOf(t *testing.T) {
+	require.Equal(t, CategoryNone, CategoryOf(nil))
+	require.Equal(t, CategoryInternal, CategoryOf(errors.New("boom")))
+	require.Equal(t, CategorySchema, CategoryOf(fmt.Errorf("wrapped: %w", categorized(CategorySchema, errors.New("boom")))))
+	require.Equal(t, CategoryCanceled, CategoryOf(status.Error(codes.DeadlineExceeded, "too slow")))
+	require.Equal(t, CategoryInvalidArgument, CategoryOf(status.Error(codes.FailedPrecondition, "no such definition")))
+}
+
+func TestCategoryJSON(t *testing.T) {
+	data, err := json.Marshal(CategoryExpectedRelations)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"code":6,"name":"expected_relations_mismatch"}`, string(data))
+
+	var category Category
+	require.NoError(t, json.Unmarshal(data, &category))
+	require.Equal(t, CategoryExpectedRelations, category)
+
+	data, err = json.Marshal(NewResult("test.yaml"))
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "category")
+}
@@ -0,0 +1,61 @@
+package validate
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+)
+
+// CaveatEvaluation is a caveat evaluated while running a check.
+type CaveatEvaluation struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+
+	// Result is one of "true", "false", "missing_some_context" or
+	// "unevaluated".
+	Result string `json:"result"`
+
+	// Context is the context the caveat was evaluated with, merged from the
+	// relationship and the check.
+	Context map[string]any `json:"context,omitempty"`
+
+	// MissingContext lists the parameters the caveat required but that were
+	// not supplied.
+	MissingContext []string `json:"missingContext,omitempty"`
+}
+
+// caveatEvaluations returns the caveats evaluated in the trace, in the order
+// they first appear in it. A caveat on a relation is reported at every level
+// of the trace that resolves through it, so repeated evaluations are dropped.
+func caveatEvaluations(trace *v1.CheckDebugTrace) []CaveatEvaluation {
+	var evaluations []CaveatEvaluation
+	var walk func(trace *v1.CheckDebugTrace)
+	walk = func(trace *v1.CheckDebugTrace) {
+		if trace == nil {
+			return
+		}
+		if info := trace.CaveatEvaluationInfo; info != nil {
+			evaluation := CaveatEvaluation{
+				Name:       info.CaveatName,
+				Expression: info.Expression,
+				Result:     strings.ToLower(strings.TrimPrefix(info.Result.String(), "RESULT_")),
+			}
+			if info.Context != nil {
+				evaluation.Context = info.Context.AsMap()
+			}
+			if info.PartialCaveatInfo != nil {
+				evaluation.MissingContext = info.PartialCaveatInfo.MissingRequiredContext
+			}
+			if !slices.ContainsFunc(evaluations, func(e CaveatEvaluation) bool { return reflect.DeepEqual(e, evaluation) }) {
+				evaluations = append(evaluations, evaluation)
+			}
+		}
+		for _, sub := range trace.GetSubProblems().GetTraces() {
+			walk(sub)
+		}
+	}
+	walk(trace)
+	return evaluations
+}
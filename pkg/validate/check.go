@@ -0,0 +1,135 @@
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/authzed/spicedb/pkg/development"
+	v1dispatch "github.com/authzed/spicedb/pkg/proto/dispatch/v1"
+	"github.com/authzed/spicedb/pkg/tuple"
+	"github.com/leetrout/python-spicedb-validation/pkg/printers"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// CheckResult is the outcome of a permission check against a document.
+type CheckResult struct {
+	// Permissionship is one of "has_permission", "no_permission" or
+	// "conditional_permission".
+	Permissionship string `json:"permissionship,omitempty"`
+
+	// MissingContext lists the caveat parameters that were required but not
+	// supplied, for conditional results.
+	MissingContext []string `json:"missingContext,omitempty"`
+
+	// Caveats are the caveats evaluated by the check.
+	Caveats []CaveatEvaluation `json:"caveats,omitempty"`
+
+	// Trace is the v1.CheckDebugTrace of the check, in protobuf JSON form.
+	Trace json.RawMessage `json:"trace,omitempty"`
+
+	// TraceText is the trace as rendered by printers.DisplayCheckTrace,
+	// without colors.
+	TraceText string `json:"traceText,omitempty"`
+
+	// debugTrace is the trace itself, for RenderTrace.
+	debugTrace *v1.CheckDebugTrace
+}
+
+// Check checks whether the subject has the permission on the resource. The
+// resource is of the form `type:id` and the subject `type:id` or
+// `type:id#relation`. The caveat context may be nil.
+func (doc *Document) Check(ctx context.Context, resource, permission, subject string, caveatContext map[string]any) (*CheckResult, error) {
+	resourceONR := tuple.ParseONR(resource + "#" + permission)
+	if resourceONR == nil {
+		return nil, categorized(CategoryInvalidArgument, fmt.Errorf("invalid resource `%s` or permission `%s`", resource, permission))
+	}
+
+	subjectONR := tuple.ParseSubjectONR(subject)
+	if subjectONR == nil {
+		return nil, categorized(CategoryInvalidArgument, fmt.Errorf("invalid subject `%s`", subject))
+	}
+
+	doc.mu.RLock()
+	defer doc.mu.RUnlock()
+	if err := doc.usable(ctx); err != nil {
+		return nil, err
+	}
+
+	cr, err := development.RunCheck(doc.devContext(ctx), resourceONR, subjectONR, caveatContext)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CheckResult{
+		Permissionship: permissionshipString(cr.Permissionship),
+		MissingContext: cr.MissingCaveatFields,
+	}
+
+	if cr.V1DebugInfo != nil && cr.V1DebugInfo.Check != nil {
+		result.Caveats = caveatEvaluations(cr.V1DebugInfo.Check)
+		result.Trace, result.TraceText, err = encodeCheckTrace(cr.V1DebugInfo.Check)
+		if err != nil {
+			return nil, err
+		}
+		result.debugTrace = cr.V1DebugInfo.Check
+	}
+
+	return result, nil
+}
+
+// RenderTrace writes the trace as in TraceText, colored according to mode.
+// It writes nothing if the check has no trace.
+func (r *CheckResult) RenderTrace(w io.Writer, mode ColorMode) error {
+	if r.debugTrace == nil {
+		return nil
+	}
+	tp := printers.NewTreePrinter()
+	printers.DisplayCheckTrace(r.debugTrace, tp, false, newRenderer(w, mode).lg)
+	_, err := io.WriteString(w, tp.String())
+	return err
+}
+
+// encodeCheckTrace returns the trace in protobuf JSON form and as rendered by
+// printers.DisplayCheckTrace, without colors, as it is meant to be read by
+// programs rather than terminals.
+func encodeCheckTrace(trace *v1.CheckDebugTrace) (json.RawMessage, string, error) {
+	data, err := protojson.Marshal(trace)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tp := printers.NewTreePrinter()
+	printers.DisplayCheckTrace(trace, tp, false, nil)
+	return data, tp.String(), nil
+}
+
+// ParseCaveatContext parses an optional JSON object of caveat context, as
+// accepted by Check and the lookups.
+func ParseCaveatContext(caveatContext string) (map[string]any, error) {
+	if strings.TrimSpace(caveatContext) == "" {
+		return nil, nil
+	}
+
+	var contextMap map[string]any
+	if err := json.Unmarshal([]byte(caveatContext), &contextMap); err != nil {
+		return nil, categorized(CategoryInvalidArgument, fmt.Errorf("invalid caveat context: %w", err))
+	}
+	return contextMap, nil
+}
+
+func permissionshipString(membership v1dispatch.ResourceCheckResult_Membership) string {
+	var permissionship v1.CheckPermissionResponse_Permissionship
+	switch membership {
+	case v1dispatch.ResourceCheckResult_MEMBER:
+		permissionship = v1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION
+	case v1dispatch.ResourceCheckResult_CAVEATED_MEMBER:
+		permissionship = v1.CheckPermissionResponse_PERMISSIONSHIP_CONDITIONAL_PERMISSION
+	default:
+		permissionship = v1.CheckPermissionResponse_PERMISSIONSHIP_NO_PERMISSION
+	}
+	return strings.ToLower(strings.TrimPrefix(permissionship.String(), "PERMISSIONSHIP_"))
+}
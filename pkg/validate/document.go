@@ -0,0 +1,357 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/authzed/spicedb/pkg/development"
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
+	devinterface "github.com/authzed/spicedb/pkg/proto/developer/v1"
+	"github.com/authzed/spicedb/pkg/spiceerrors"
+	"github.com/authzed/spicedb/pkg/tuple"
+	"github.com/authzed/spicedb/pkg/validationfile"
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+)
+
+// ErrClosed is returned by operations on a document that has been closed.
+var ErrClosed = errors.New("document is closed")
+
+// Document is a decoded validation document loaded into a development
+// context, ready to have operations run against it. It is safe for
+// concurrent use.
+type Document struct {
+	// mu is held for reading while an operation runs against the development
+	// context and for writing while the document is closed.
+	mu sync.RWMutex
+
+	file     string
+	failFast bool
+	contents []byte
+	parsed   validationfile.ValidationFile
+	devCtx   *development.DevContext
+	closed   bool
+
+	// loaded is the result of Load, which Validate starts from.
+	loaded *Result
+
+	// references are the files the document referenced.
+	references references
+
+	// dropped are the relationships left out with Options.KeepGoing.
+	dropped droppedRelationships
+
+	// serviceMu guards the lazily started in-memory v1 API server used by
+	// operations that are not exposed by the development package.
+	serviceMu    sync.Mutex
+	client       v1.PermissionsServiceClient
+	closeService func()
+}
+
+// Load decodes a document and builds its development context, running the
+// parse, relationships and schema phases. If any of them fails the returned
+// document is nil and the result holds the errors; otherwise the document
+// must be closed once no longer needed.
+//
+// With Options.KeepGoing, relationships that are invalid or do not fit the
+// schema are reported and left out, and the document is still returned.
+func Load(ctx context.Context, opts Options) (*Document, *Result) {
+	keepGoing := opts.KeepGoing && !opts.FailFast
+	result := NewResult(opts.Source)
+	decoder, err := opts.decoder()
+	if err != nil {
+		return nil, result.failPhase(PhaseParse, categorized(CategoryDecode, err))
+	}
+
+	doc := &Document{file: opts.Source, failFast: opts.FailFast, dropped: droppedRelationships{}, references: references{}}
+
+	contents, err := decoder(decode.WithReferrer(ctx, doc.references), &doc.parsed)
+	doc.contents = contents
+	result.contents = contents
+	lines := doc.lines()
+	for _, ref := range doc.references {
+		result.addReferenced(ref.Source, ref.Contents)
+	}
+	if err != nil {
+		var refErr *decode.ReferenceError
+		if errors.As(err, &refErr) {
+			result.addReferenced(refErr.Reference.Source, refErr.Reference.Contents)
+		}
+		var errWithSource *spiceerrors.ErrorWithSource
+		var syntaxErr *decode.SyntaxError
+		switch {
+		case errors.As(err, &errWithSource) && refErr != nil:
+			result.addReferenceErrorWithSource(refErr.Reference, errWithSource)
+		case errors.As(err, &errWithSource):
+			result.addErrorWithSource(lines, errWithSource)
+		case errors.As(err, &syntaxErr) && refErr != nil:
+			result.addReferenceSyntaxError(refErr.Reference, syntaxErr)
+		case errors.As(err, &syntaxErr):
+			result.addSyntaxError(lines, syntaxErr)
+		default:
+			return nil, result.failPhase(PhaseParse, decodeError(err))
+		}
+	}
+	if !result.endPhase(PhaseParse, 0) {
+		return nil, result
+	}
+
+	relationships := doc.references.source(decode.RelationshipsFileKey, lines)
+	tuples := make([]*core.RelationTuple, 0, len(doc.parsed.Relationships.Relationships))
+	for _, rel := range doc.parsed.Relationships.Relationships {
+		if err := rel.Validate(); err != nil {
+			errorsBefore := len(result.Errors)
+			result.addRelationshipError(relationships.lines, rel, err)
+			result.inFile(errorsBefore, relationships.file)
+			doc.dropped.addRelationship(rel)
+			if doc.failFast {
+				break
+			}
+			continue
+		}
+		tuples = append(tuples, tuple.FromRelationship[*v1.ObjectReference, *v1.SubjectReference, *v1.ContextualizedCaveat](rel))
+	}
+	if !result.endPhase(PhaseRelationships, 0) && !keepGoing {
+		return nil, result
+	}
+
+	errorsBefore := len(result.Errors)
+	devCtx, devErrs, err := doc.newDevContext(ctx, tuples)
+	if err != nil {
+		return nil, result.failPhase(PhaseSchema, err)
+	}
+	if devErrs != nil {
+		doc.addDeveloperErrors(result, lines, devErrs.InputErrors)
+		if keepGoing {
+			var rejected []*core.RelationTuple
+			tuples, rejected, err = rejectedTuples(tuples, devErrs.InputErrors)
+			if err != nil {
+				return nil, result.failPhase(PhaseSchema, categorized(CategoryRelationship, err))
+			}
+			if len(rejected) > 0 {
+				for _, tpl := range rejected {
+					if err := doc.dropped.addTuple(tpl); err != nil {
+						return nil, result.failPhase(PhaseSchema, categorized(CategoryRelationship, err))
+					}
+				}
+				devCtx, devErrs, err = doc.newDevContext(ctx, tuples)
+				if err != nil {
+					return nil, result.failPhase(PhaseSchema, err)
+				}
+				if devErrs != nil {
+					doc.addDeveloperErrors(result, lines, devErrs.InputErrors)
+				}
+			}
+		}
+	}
+	result.endPhase(PhaseSchema, errorsBefore)
+	if devCtx == nil || devErrs != nil {
+		return nil, result
+	}
+	result.RelationshipsLoaded = len(tuples)
+
+	// The development context outlives this call, so it must not be canceled
+	// with it; each operation supplies its own cancellation via devContext.
+	devCtx.Ctx = context.WithoutCancel(devCtx.Ctx)
+	doc.devCtx = devCtx
+	doc.loaded = result.clone()
+	return doc, result
+}
+
+// addDeveloperErrors adds the errors building the development context of
+// the document, each pointing into the file its schema or relationships came
+// from.
+func (doc *Document) addDeveloperErrors(result *Result, lines []string, devErrs []*devinterface.DeveloperError) {
+	schema := doc.references.source(decode.SchemaFileKey, lines)
+	relationships := doc.references.source(decode.RelationshipsFileKey, lines)
+	for _, devErr := range devErrs {
+		src := schema
+		if devErr.Source == devinterface.DeveloperError_RELATIONSHIP {
+			src = relationships
+		}
+		errorsBefore := len(result.Errors)
+		result.addDeveloperErrors(src.lines, []*devinterface.DeveloperError{devErr}, src.lineOffset)
+		result.inFile(errorsBefore, src.file)
+	}
+}
+
+// newDevContext builds a development context over the schema of the document
+// and the given relationships.
+func (doc *Document) newDevContext(ctx context.Context, tuples []*core.RelationTuple) (*development.DevContext, *devinterface.DeveloperErrors, error) {
+	return development.NewDevContext(ctx, &devinterface.RequestContext{
+		Schema:        doc.parsed.Schema.Schema,
+		Relationships: tuples,
+	})
+}
+
+// decodeError classifies an error returned by a decoder that is not about
+// the contents of the document: anything that is not a cancellation is a
+// decode error.
+func decodeError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return categorized(CategoryDecode, err)
+}
+
+// File returns the source the document was loaded from.
+func (doc *Document) File() string {
+	return doc.file
+}
+
+// usable returns an error if the document has been closed or the call has
+// already been canceled. It must be called with doc.mu held.
+func (doc *Document) usable(ctx context.Context) error {
+	if doc.closed {
+		return ErrClosed
+	}
+	return ctx.Err()
+}
+
+// devContext returns the development context of the document, bound to the
+// cancellation and deadline of the given context. It must be called with
+// doc.mu held.
+func (doc *Document) devContext(ctx context.Context) *development.DevContext {
+	devCtx := *doc.devCtx
+	devCtx.Ctx = callContext{Context: ctx, values: doc.devCtx.Ctx}
+	return &devCtx
+}
+
+// callContext takes its values, such as the datastore, from the development
+// context's own context, and its cancellation and deadline from the call.
+type callContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c callContext) Value(key any) any {
+	if value := c.values.Value(key); value != nil {
+		return value
+	}
+	return c.Context.Value(key)
+}
+
+func (doc *Document) lines() []string {
+	return strings.Split(string(doc.contents), "\n")
+}
+
+// Validate runs the assertions and expected relations of the document. The
+// phases run by Load are reported as they were by Load, along with any errors
+// it found in a document loaded with Options.KeepGoing.
+func (doc *Document) Validate(ctx context.Context) *Result {
+	return doc.validate(ctx, doc.loaded.clone())
+}
+
+// validate runs the assertions and expected relations of the document,
+// recording the outcome in the result.
+func (doc *Document) validate(ctx context.Context, result *Result) *Result {
+	doc.mu.RLock()
+	defer doc.mu.RUnlock()
+	if err := doc.usable(ctx); err != nil {
+		return result.failPhase(PhaseAssertions, err)
+	}
+
+	devCtx := doc.devContext(ctx)
+
+	lines := doc.lines()
+	result.contents = doc.contents
+
+	errorsBefore := len(result.Errors)
+	assertions, adevErrs, err := runAssertions(devCtx, &doc.parsed.Assertions, doc.dropped)
+	if err != nil {
+		return result.failPhase(PhaseAssertions, err)
+	}
+	result.Assertions = assertions
+	for _, assertion := range assertions {
+		switch {
+		case assertion.Skipped:
+			result.AssertionsSkipped++
+		case assertion.Caveated():
+			result.CaveatedAssertionsRun++
+			fallthrough
+		default:
+			result.AssertionsRun++
+		}
+	}
+	result.addDeveloperErrors(lines, adevErrs, 0)
+	passed := result.endPhase(PhaseAssertions, errorsBefore)
+	if !passed && doc.failFast {
+		return result
+	}
+	if passed && len(assertions) > 0 && result.AssertionsSkipped == len(assertions) {
+		result.setPhase(PhaseAssertions, PhaseSkipped)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result.failPhase(PhaseExpectedRelations, err)
+	}
+
+	errorsBefore = len(result.Errors)
+	expectedRelations, skipped := doc.dropped.expectedRelations(devCtx.CompiledSchema, &doc.parsed.ExpectedRelations)
+	_, erDevErrs, err := development.RunValidation(devCtx, expectedRelations)
+	if err != nil {
+		return result.failPhase(PhaseExpectedRelations, err)
+	}
+	result.ExpectedRelationsValidated = len(expectedRelations.ValidationMap)
+	result.ExpectedRelationsSkipped = skipped
+	result.addDeveloperErrors(lines, erDevErrs, 0)
+	if result.endPhase(PhaseExpectedRelations, errorsBefore) && skipped > 0 && len(expectedRelations.ValidationMap) == 0 {
+		result.setPhase(PhaseExpectedRelations, PhaseSkipped)
+	}
+
+	return result
+}
+
+// Close releases the development context. It waits for any running
+// operations to finish first, and does nothing if the document is already
+// closed.
+func (doc *Document) Close() {
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+	if doc.closed {
+		return
+	}
+	doc.closed = true
+	if doc.closeService != nil {
+		doc.closeService()
+	}
+	doc.devCtx.Dispose()
+}
+
+// permissionsClient returns a client for the v1 permissions API served over
+// the document's development context, starting the server on first use. It
+// must be called with doc.mu held.
+func (doc *Document) permissionsClient() (v1.PermissionsServiceClient, error) {
+	doc.serviceMu.Lock()
+	defer doc.serviceMu.Unlock()
+	if doc.client != nil {
+		return doc.client, nil
+	}
+
+	conn, closeService, err := doc.devCtx.RunV1InMemoryService()
+	if err != nil {
+		return nil, err
+	}
+
+	doc.client = v1.NewPermissionsServiceClient(conn)
+	doc.closeService = closeService
+	return doc.client, nil
+}
+
+// withPermissionsClient runs fn with the v1 permissions client of the
+// document, holding the document open for the duration of the call.
+func (doc *Document) withPermissionsClient(ctx context.Context, fn func(client v1.PermissionsServiceClient) error) error {
+	doc.mu.RLock()
+	defer doc.mu.RUnlock()
+	if err := doc.usable(ctx); err != nil {
+		return err
+	}
+
+	client, err := doc.permissionsClient()
+	if err != nil {
+		return err
+	}
+	return fn(client)
+}
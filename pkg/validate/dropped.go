@@ -0,0 +1,183 @@
+package validate
+
+import (
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
+	devinterface "github.com/authzed/spicedb/pkg/proto/developer/v1"
+	"github.com/authzed/spicedb/pkg/schemadsl/compiler"
+	"github.com/authzed/spicedb/pkg/tuple"
+	"github.com/authzed/spicedb/pkg/validationfile/blocks"
+)
+
+// droppedRelationships are the relationships left out of a document loaded
+// with Options.KeepGoing, keyed by the relation they were written to, as
+// `type#relation`.
+//
+// Assertions and expected relations whose relation or permission can reach
+// one of these relations through the schema are skipped, as their outcome
+// would depend on what is missing. A relation reached on the checked object
+// itself only matches relationships of that object; one reached through an
+// arrow or a subject set matches those of any object, as which objects are
+// walked depends on the relationships.
+type droppedRelationships map[string][]droppedRelationship
+
+// droppedRelationship is a relationship left out of the document: the ID of
+// its resource, and the relationship as written.
+type droppedRelationship struct {
+	objectID  string
+	relString string
+}
+
+func (d droppedRelationships) addRelationship(rel *v1.Relationship) {
+	d.add(rel.Resource.ObjectType, rel.Resource.ObjectId, rel.Relation, tuple.StringRelationshipWithoutCaveat(rel))
+}
+
+func (d droppedRelationships) addTuple(tpl *core.RelationTuple) error {
+	tplString, err := tuple.String(tpl)
+	if err != nil {
+		return err
+	}
+	onr := tpl.ResourceAndRelation
+	d.add(onr.Namespace, onr.ObjectId, onr.Relation, tplString)
+	return nil
+}
+
+func (d droppedRelationships) add(objectType, objectID, relation, relString string) {
+	key := objectType + "#" + relation
+	d[key] = append(d[key], droppedRelationship{objectID: objectID, relString: relString})
+}
+
+// affecting returns a dropped relationship the given relation or permission
+// can reach through the schema, if any.
+func (d droppedRelationships) affecting(schema *compiler.CompiledSchema, onr *core.ObjectAndRelation) (string, bool) {
+	if len(d) == 0 {
+		return "", false
+	}
+
+	definitions := map[string]*core.NamespaceDefinition{}
+	for _, def := range schema.ObjectDefinitions {
+		definitions[def.Name] = def
+	}
+
+	type reached struct {
+		objectType, relation string
+		sameObject           bool
+	}
+	seen := map[reached]bool{}
+	pending := []reached{{onr.Namespace, onr.Relation, true}}
+	for len(pending) > 0 {
+		next := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[next] {
+			continue
+		}
+		seen[next] = true
+
+		for _, dropped := range d[next.objectType+"#"+next.relation] {
+			if !next.sameObject || dropped.objectID == onr.ObjectId {
+				return dropped.relString, true
+			}
+		}
+
+		relation := findRelation(definitions[next.objectType], next.relation)
+		if relation == nil {
+			continue
+		}
+		for _, allowed := range relation.GetTypeInformation().GetAllowedDirectRelations() {
+			if subjectRelation := allowed.GetRelation(); subjectRelation != "" && subjectRelation != tuple.Ellipsis {
+				pending = append(pending, reached{allowed.Namespace, subjectRelation, false})
+			}
+		}
+		for _, child := range rewriteChildren(relation.UsersetRewrite) {
+			switch {
+			case child.GetComputedUserset() != nil:
+				pending = append(pending, reached{next.objectType, child.GetComputedUserset().Relation, next.sameObject})
+			case child.GetTupleToUserset() != nil:
+				ttu := child.GetTupleToUserset()
+				pending = append(pending, reached{next.objectType, ttu.Tupleset.Relation, next.sameObject})
+				tupleset := findRelation(definitions[next.objectType], ttu.Tupleset.Relation)
+				for _, allowed := range tupleset.GetTypeInformation().GetAllowedDirectRelations() {
+					pending = append(pending, reached{allowed.Namespace, ttu.ComputedUserset.Relation, false})
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// findRelation returns the relation or permission of the definition with the
+// given name, or nil.
+func findRelation(def *core.NamespaceDefinition, name string) *core.Relation {
+	for _, relation := range def.GetRelation() {
+		if relation.Name == name {
+			return relation
+		}
+	}
+	return nil
+}
+
+// rewriteChildren returns every child of the rewrite, including those of
+// nested rewrites.
+func rewriteChildren(rewrite *core.UsersetRewrite) []*core.SetOperation_Child {
+	if rewrite == nil {
+		return nil
+	}
+	var children []*core.SetOperation_Child
+	for _, op := range []*core.SetOperation{rewrite.GetUnion(), rewrite.GetIntersection(), rewrite.GetExclusion()} {
+		for _, child := range op.GetChild() {
+			children = append(children, child)
+			children = append(children, rewriteChildren(child.GetUsersetRewrite())...)
+		}
+	}
+	return children
+}
+
+// expectedRelations returns the expected relations without those affected by
+// a dropped relationship, and how many were left out.
+func (d droppedRelationships) expectedRelations(schema *compiler.CompiledSchema, expected *blocks.ParsedExpectedRelations) (*blocks.ParsedExpectedRelations, int) {
+	if len(d) == 0 {
+		return expected, 0
+	}
+
+	kept := &blocks.ParsedExpectedRelations{
+		ValidationMap:  blocks.ValidationMap{},
+		SourcePosition: expected.SourcePosition,
+	}
+	skipped := 0
+	for key, subjects := range expected.ValidationMap {
+		if _, ok := d.affecting(schema, key.ObjectAndRelation); ok {
+			skipped++
+			continue
+		}
+		kept.ValidationMap[key] = subjects
+	}
+	return kept, skipped
+}
+
+// rejectedTuples splits the tuples into those the development context
+// accepted and those it rejected with the given input errors. It returns no
+// rejected tuples if any of the errors is not about a single relationship,
+// as then the document cannot be loaded without them.
+func rejectedTuples(tuples []*core.RelationTuple, inputErrors []*devinterface.DeveloperError) ([]*core.RelationTuple, []*core.RelationTuple, error) {
+	rejectedStrings := map[string]bool{}
+	for _, devErr := range inputErrors {
+		if devErr.Source != devinterface.DeveloperError_RELATIONSHIP || devErr.Context == "" {
+			return tuples, nil, nil
+		}
+		rejectedStrings[devErr.Context] = true
+	}
+
+	var accepted, rejected []*core.RelationTuple
+	for _, tpl := range tuples {
+		tplString, err := tuple.String(tpl)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rejectedStrings[tplString] {
+			rejected = append(rejected, tpl)
+			continue
+		}
+		accepted = append(accepted, tpl)
+	}
+	return accepted, rejected, nil
+}
@@ -0,0 +1,151 @@
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/authzed/spicedb/pkg/tuple"
+	"github.com/leetrout/python-spicedb-validation/pkg/printers"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// maxExpandDepth bounds an unlimited expansion, matching the dispatch depth
+// used by the development package.
+const maxExpandDepth = 25
+
+// ExpandResult is the outcome of expanding a permission in a document.
+type ExpandResult struct {
+	// Tree is the v1.PermissionRelationshipTree, in protobuf JSON form.
+	Tree json.RawMessage `json:"tree,omitempty"`
+
+	// TreeText is the tree as rendered by printers.TreeNodeTree.
+	TreeText string `json:"treeText,omitempty"`
+}
+
+// Expand expands the permission on the resource. Subject sets found in the
+// tree are expanded in turn until depth levels have been expanded; a depth
+// of zero or less expands fully.
+func (doc *Document) Expand(ctx context.Context, resource, permission string, depth int) (*ExpandResult, error) {
+	resourceONR := tuple.ParseONR(resource + "#" + permission)
+	if resourceONR == nil {
+		return nil, categorized(CategoryInvalidArgument, fmt.Errorf("invalid resource `%s` or permission `%s`", resource, permission))
+	}
+
+	if depth <= 0 || depth > maxExpandDepth {
+		depth = maxExpandDepth
+	}
+
+	var tree *v1.PermissionRelationshipTree
+	err := doc.withPermissionsClient(ctx, func(client v1.PermissionsServiceClient) error {
+		expander := &treeExpander{client: client, ctx: ctx}
+
+		var err error
+		tree, err = expander.expand(&v1.ObjectReference{
+			ObjectType: resourceONR.Namespace,
+			ObjectId:   resourceONR.ObjectId,
+		}, resourceONR.Relation, depth, map[string]struct{}{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	treeJSON, err := protojson.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := printers.NewTreePrinter()
+	if err := printers.TreeNodeTree(tp, tree); err != nil {
+		return nil, err
+	}
+	return &ExpandResult{Tree: treeJSON, TreeText: tp.String()}, nil
+}
+
+type treeExpander struct {
+	client v1.PermissionsServiceClient
+	ctx    context.Context
+}
+
+// expand runs a (shallow) ExpandPermissionTree call and then replaces each
+// leaf containing subject sets with a union of its direct subjects and the
+// expansions of those subject sets. The seen set holds the subject sets on
+// the current path so cycles are not followed.
+func (te *treeExpander) expand(resource *v1.ObjectReference, permission string, depth int, seen map[string]struct{}) (*v1.PermissionRelationshipTree, error) {
+	resp, err := te.client.ExpandPermissionTree(te.ctx, &v1.ExpandPermissionTreeRequest{
+		Consistency: fullyConsistent(),
+		Resource:    resource,
+		Permission:  permission,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	key := tuple.StringObjectRef(resource) + "#" + permission
+	seen[key] = struct{}{}
+	defer delete(seen, key)
+
+	if err := te.expandLeaves(resp.TreeRoot, depth-1, seen); err != nil {
+		return nil, err
+	}
+	return resp.TreeRoot, nil
+}
+
+func (te *treeExpander) expandLeaves(node *v1.PermissionRelationshipTree, depth int, seen map[string]struct{}) error {
+	switch typed := node.TreeType.(type) {
+	case *v1.PermissionRelationshipTree_Intermediate:
+		for _, child := range typed.Intermediate.Children {
+			if err := te.expandLeaves(child, depth, seen); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *v1.PermissionRelationshipTree_Leaf:
+		if depth <= 0 {
+			return nil
+		}
+
+		var direct []*v1.SubjectReference
+		var expanded []*v1.PermissionRelationshipTree
+		for _, subject := range typed.Leaf.Subjects {
+			key := tuple.StringObjectRef(subject.Object) + "#" + subject.OptionalRelation
+			if _, ok := seen[key]; subject.OptionalRelation == "" || ok {
+				direct = append(direct, subject)
+				continue
+			}
+
+			child, err := te.expand(subject.Object, subject.OptionalRelation, depth, seen)
+			if err != nil {
+				return err
+			}
+			expanded = append(expanded, child)
+		}
+
+		if len(expanded) == 0 {
+			return nil
+		}
+
+		children := expanded
+		if len(direct) > 0 {
+			children = append([]*v1.PermissionRelationshipTree{{
+				TreeType: &v1.PermissionRelationshipTree_Leaf{
+					Leaf: &v1.DirectSubjectSet{Subjects: direct},
+				},
+			}}, expanded...)
+		}
+
+		node.TreeType = &v1.PermissionRelationshipTree_Intermediate{
+			Intermediate: &v1.AlgebraicSubjectSet{
+				Operation: v1.AlgebraicSubjectSet_OPERATION_UNION,
+				Children:  children,
+			},
+		}
+		return nil
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,189 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
+	"github.com/authzed/spicedb/pkg/tuple"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// LookupEntry is a single resource or subject found by a lookup.
+type LookupEntry struct {
+	ObjectID string `json:"objectId"`
+
+	// Permissionship is "has_permission" or "conditional_permission".
+	Permissionship string `json:"permissionship"`
+
+	// MissingContext lists the caveat parameters required to resolve a
+	// conditional result.
+	MissingContext []string `json:"missingContext,omitempty"`
+
+	// ExcludedSubjects are the subjects excluded from a wildcard subject.
+	ExcludedSubjects []LookupEntry `json:"excludedSubjects,omitempty"`
+}
+
+// LookupResources finds the resources of the given type on which the subject
+// has the permission, sorted by ID. The caveat context may be nil.
+func (doc *Document) LookupResources(ctx context.Context, resourceType, permission, subject string, caveatContext map[string]any) ([]LookupEntry, error) {
+	subjectONR := tuple.ParseSubjectONR(subject)
+	if subjectONR == nil {
+		return nil, categorized(CategoryInvalidArgument, fmt.Errorf("invalid subject `%s`", subject))
+	}
+
+	contextStruct, err := caveatContextStruct(caveatContext)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []LookupEntry{}
+	err = doc.withPermissionsClient(ctx, func(client v1.PermissionsServiceClient) error {
+		stream, err := client.LookupResources(ctx, &v1.LookupResourcesRequest{
+			Consistency:        fullyConsistent(),
+			ResourceObjectType: resourceType,
+			Permission:         permission,
+			Subject:            subjectReference(subjectONR),
+			Context:            contextStruct,
+		})
+		if err != nil {
+			return err
+		}
+
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			results = append(results, LookupEntry{
+				ObjectID:       resp.ResourceObjectId,
+				Permissionship: lookupPermissionshipString(resp.Permissionship),
+				MissingContext: resp.GetPartialCaveatInfo().GetMissingRequiredContext(),
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortLookupEntries(results)
+	return results, nil
+}
+
+// LookupSubjects finds the subjects of the given type that have the
+// permission on the resource, sorted by ID. The subject type may include a
+// relation, as in `group#member`. The caveat context may be nil.
+func (doc *Document) LookupSubjects(ctx context.Context, resource, permission, subjectType string, caveatContext map[string]any) ([]LookupEntry, error) {
+	resourceONR := tuple.ParseONR(resource + "#" + permission)
+	if resourceONR == nil {
+		return nil, categorized(CategoryInvalidArgument, fmt.Errorf("invalid resource `%s` or permission `%s`", resource, permission))
+	}
+
+	subjectObjectType, subjectRelation, _ := strings.Cut(subjectType, "#")
+
+	contextStruct, err := caveatContextStruct(caveatContext)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []LookupEntry{}
+	err = doc.withPermissionsClient(ctx, func(client v1.PermissionsServiceClient) error {
+		stream, err := client.LookupSubjects(ctx, &v1.LookupSubjectsRequest{
+			Consistency: fullyConsistent(),
+			Resource: &v1.ObjectReference{
+				ObjectType: resourceONR.Namespace,
+				ObjectId:   resourceONR.ObjectId,
+			},
+			Permission:              resourceONR.Relation,
+			SubjectObjectType:       subjectObjectType,
+			OptionalSubjectRelation: subjectRelation,
+			Context:                 contextStruct,
+		})
+		if err != nil {
+			return err
+		}
+
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			entry := resolvedSubjectEntry(resp.Subject)
+			for _, excluded := range resp.ExcludedSubjects {
+				entry.ExcludedSubjects = append(entry.ExcludedSubjects, resolvedSubjectEntry(excluded))
+			}
+			sortLookupEntries(entry.ExcludedSubjects)
+			results = append(results, entry)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortLookupEntries(results)
+	return results, nil
+}
+
+func fullyConsistent() *v1.Consistency {
+	return &v1.Consistency{
+		Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true},
+	}
+}
+
+func subjectReference(onr *core.ObjectAndRelation) *v1.SubjectReference {
+	relation := onr.Relation
+	if relation == tuple.Ellipsis {
+		relation = ""
+	}
+
+	return &v1.SubjectReference{
+		Object: &v1.ObjectReference{
+			ObjectType: onr.Namespace,
+			ObjectId:   onr.ObjectId,
+		},
+		OptionalRelation: relation,
+	}
+}
+
+func caveatContextStruct(contextMap map[string]any) (*structpb.Struct, error) {
+	if contextMap == nil {
+		return nil, nil
+	}
+
+	contextStruct, err := structpb.NewStruct(contextMap)
+	if err != nil {
+		return nil, categorized(CategoryInvalidArgument, fmt.Errorf("invalid caveat context: %w", err))
+	}
+	return contextStruct, nil
+}
+
+func resolvedSubjectEntry(subject *v1.ResolvedSubject) LookupEntry {
+	return LookupEntry{
+		ObjectID:       subject.SubjectObjectId,
+		Permissionship: lookupPermissionshipString(subject.Permissionship),
+		MissingContext: subject.GetPartialCaveatInfo().GetMissingRequiredContext(),
+	}
+}
+
+func lookupPermissionshipString(permissionship v1.LookupPermissionship) string {
+	return strings.ToLower(strings.TrimPrefix(permissionship.String(), "LOOKUP_PERMISSIONSHIP_"))
+}
+
+func sortLookupEntries(entries []LookupEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ObjectID < entries[j].ObjectID
+	})
+}
@@ -0,0 +1,73 @@
+package validate
+
+import (
+	"strings"
+
+	"github.com/authzed/spicedb/pkg/spiceerrors"
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+)
+
+// references are the files a document referenced for its schema or
+// relationships, by referencing key.
+type references map[string]decode.Reference
+
+// AddReference implements decode.Referrer.
+func (r references) AddReference(ref decode.Reference) {
+	r[ref.Key] = ref
+}
+
+// sourceFile is a file errors can point into.
+type sourceFile struct {
+	// file is the source of a referenced file, or empty for the document.
+	file  string
+	lines []string
+
+	// lineOffset is the line the value starts after.
+	lineOffset int
+}
+
+// source returns the file holding the value the referencing key stands for:
+// the referenced file if there is one, and otherwise the document, given by
+// its lines.
+func (r references) source(key string, lines []string) sourceFile {
+	ref, ok := r[key]
+	if !ok {
+		return sourceFile{lines: lines, lineOffset: 1 /* for the 'schema:' */}
+	}
+	return referenceSource(ref)
+}
+
+func referenceSource(ref decode.Reference) sourceFile {
+	return sourceFile{
+		file:       ref.Source,
+		lines:      strings.Split(string(ref.Contents), "\n"),
+		lineOffset: ref.Line,
+	}
+}
+
+// addReferenceErrorWithSource adds an error decoding the value read from a
+// referenced file, pointing into that file.
+func (r *Result) addReferenceErrorWithSource(ref decode.Reference, errWithSource *spiceerrors.ErrorWithSource) {
+	src := referenceSource(ref)
+	located := *errWithSource
+	if ref.Key == decode.RelationshipsFileKey {
+		// Relationship lines are numbered as in an inline YAML block, so
+		// find the relationship instead.
+		located.LineNumber = uint64(lineContaining(src.lines, errWithSource.SourceCodeString))
+	} else {
+		located.LineNumber += uint64(src.lineOffset)
+	}
+
+	errorsBefore := len(r.Errors)
+	r.addErrorWithSource(src.lines, &located)
+	r.inFile(errorsBefore, src.file)
+}
+
+// addReferenceSyntaxError adds an error unmarshalling a referenced document,
+// pointing into that document.
+func (r *Result) addReferenceSyntaxError(ref decode.Reference, syntaxErr *decode.SyntaxError) {
+	src := referenceSource(ref)
+	errorsBefore := len(r.Errors)
+	r.addSyntaxError(src.lines, syntaxErr)
+	r.inFile(errorsBefore, src.file)
+}
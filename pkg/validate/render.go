@@ -0,0 +1,168 @@
+package validate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/leetrout/python-spicedb-validation/pkg/printers"
+	"github.com/muesli/termenv"
+)
+
+// styles are the lipgloss styles used to render validation output.
+type styles struct {
+	success                string
+	errorPrefix            string
+	errorMessageStyle      lipgloss.Style
+	linePrefixStyle        lipgloss.Style
+	highlightedSourceStyle lipgloss.Style
+	highlightedLineStyle   lipgloss.Style
+	codeStyle              lipgloss.Style
+	highlightedCodeStyle   lipgloss.Style
+	traceStyle             lipgloss.Style
+}
+
+func newStyles(r *lipgloss.Renderer) styles {
+	return styles{
+		success:                r.NewStyle().Bold(true).Foreground(lipgloss.Color("10")).Render("Success!"),
+		errorPrefix:            r.NewStyle().Bold(true).Foreground(lipgloss.Color("9")).Render("error: "),
+		errorMessageStyle:      r.NewStyle().Bold(true).Width(80),
+		linePrefixStyle:        r.NewStyle().Foreground(lipgloss.Color("12")),
+		highlightedSourceStyle: r.NewStyle().Foreground(lipgloss.Color("9")),
+		highlightedLineStyle:   r.NewStyle().Foreground(lipgloss.Color("9")),
+		codeStyle:              r.NewStyle().Foreground(lipgloss.Color("8")),
+		highlightedCodeStyle:   r.NewStyle().Foreground(lipgloss.Color("15")),
+		traceStyle:             r.NewStyle().Bold(true),
+	}
+}
+
+// Render writes the human-readable rendering of a result to w, in a single
+// Write so that the output of concurrent calls sharing w does not interleave.
+func Render(w io.Writer, result *Result, mode ColorMode) error {
+	return newRenderer(w, mode).result(result)
+}
+
+// renderer renders validation output to a single writer. Nothing in it is
+// shared, so every call gets its own renderer and concurrent calls never
+// write to each other's output.
+type renderer struct {
+	w      io.Writer
+	lg     *lipgloss.Renderer
+	styles styles
+}
+
+// newRenderer returns a renderer writing to w. With ColorAuto, colors follow
+// the terminal the process runs in, whatever w is.
+func newRenderer(w io.Writer, mode ColorMode) *renderer {
+	r := lipgloss.NewRenderer(w)
+	switch mode {
+	case ColorAlways:
+		r.SetColorProfile(termenv.ANSI256)
+	case ColorNever:
+		r.SetColorProfile(termenv.Ascii)
+	default:
+		r.SetColorProfile(lipgloss.ColorProfile())
+	}
+	return &renderer{w: w, lg: r, styles: newStyles(r)}
+}
+
+func (r *renderer) result(result *Result) error {
+	var out bytes.Buffer
+	if result.Status == StatusSuccess {
+		assertions := fmt.Sprintf("%d assertions run", result.AssertionsRun)
+		if result.CaveatedAssertionsRun > 0 {
+			assertions += fmt.Sprintf(" (%d caveated)", result.CaveatedAssertionsRun)
+		}
+		fmt.Fprintf(&out, "%s - %d relationships loaded, %s, %d expected relations validated\n",
+			r.styles.success,
+			result.RelationshipsLoaded,
+			assertions,
+			result.ExpectedRelationsValidated,
+		)
+	} else {
+		lines := strings.Split(string(result.contents), "\n")
+		for _, validationErr := range result.Errors {
+			if validationErr.File != "" {
+				referenced := strings.Split(string(result.referenced[validationErr.File]), "\n")
+				r.validationError(&out, validationErr.File, validationErr, referenced)
+				continue
+			}
+			r.validationError(&out, result.File, validationErr, lines)
+		}
+	}
+
+	_, err := r.w.Write(out.Bytes())
+	return err
+}
+
+func (r *renderer) validationError(out io.Writer, file string, validationErr Diagnostic, lines []string) {
+	fmt.Fprintf(out, "%s %s\n", r.styles.errorPrefix, r.styles.errorMessageStyle.Render(validationErr.Message))
+	if file != "" && validationErr.Line > 0 {
+		location := fmt.Sprintf("%s:%d", file, validationErr.Line)
+		if validationErr.Column > 0 {
+			location += fmt.Sprintf(":%d", validationErr.Column)
+		}
+		fmt.Fprintf(out, " %s %s\n", r.styles.linePrefixStyle.Render("-->"), location)
+	}
+	if validationErr.Line > 0 {
+		errorLineNumber := validationErr.Line - 1 // validationErr.Line is 1-indexed
+		for i := errorLineNumber - 3; i < errorLineNumber+3; i++ {
+			if i == errorLineNumber {
+				r.line(out, lines, i, validationErr.Context, errorLineNumber)
+			} else {
+				r.line(out, lines, i, "", errorLineNumber)
+			}
+		}
+	}
+
+	if validationErr.CheckTrace != nil {
+		fmt.Fprintf(out, "\n  %s\n", r.styles.traceStyle.Render("Explanation:"))
+		tp := printers.NewTreePrinter()
+		printers.DisplayCheckTrace(validationErr.CheckTrace, tp, true, r.lg)
+		_ = tp.FprintIndented(out)
+	}
+
+	fmt.Fprintf(out, "\n\n")
+}
+
+func (r *renderer) line(out io.Writer, lines []string, index int, highlight string, highlightLineIndex int) {
+	if index < 0 || index >= len(lines) {
+		return
+	}
+
+	lineNumberLength := len(fmt.Sprintf("%d", len(lines)))
+	lineContents := lines[index]
+	lineDelimiter := "|"
+	highlightIndex := strings.Index(lineContents, highlight)
+	lineNumberStr := fmt.Sprintf("%d", index+1)
+	spacer := strings.Repeat(" ", lineNumberLength)
+
+	lineNumberStyle := r.styles.linePrefixStyle
+	lineContentsStyle := r.styles.codeStyle
+	if index == highlightLineIndex {
+		lineNumberStyle = r.styles.highlightedLineStyle
+		lineContentsStyle = r.styles.highlightedCodeStyle
+		lineDelimiter = ">"
+	}
+
+	if highlightIndex < 0 || len(highlight) == 0 {
+		fmt.Fprintf(out, " %s %s %s\n", lineNumberStyle.Render(lineNumberStr), lineDelimiter, lineContentsStyle.Render(lineContents))
+	} else {
+		fmt.Fprintf(out, " %s %s %s%s%s\n",
+			lineNumberStyle.Render(lineNumberStr),
+			lineDelimiter,
+			lineContentsStyle.Render(lineContents[0:highlightIndex]),
+			r.styles.highlightedSourceStyle.Render(highlight),
+			lineContentsStyle.Render(lineContents[highlightIndex+len(highlight):]),
+		)
+		fmt.Fprintf(out, " %s %s %s%s%s\n",
+			lineNumberStyle.Render(spacer),
+			lineDelimiter,
+			strings.Repeat(" ", highlightIndex),
+			r.styles.highlightedSourceStyle.Render("^"),
+			r.styles.highlightedSourceStyle.Render(strings.Repeat("~", len(highlight)-1)),
+		)
+	}
+}
@@ -0,0 +1,71 @@
+package validate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRendererConcurrentCalls(t *testing.T) {
+	failing := []byte("schema: |-\n  definition user {}\nrelationships: |-\n  document:plan#viewer@user:alice\n")
+
+	var wg sync.WaitGroup
+	outputs := make([]bytes.Buffer, 10)
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			contents, filename := []byte(testDocument), fmt.Sprintf("valid-%d.yaml", i)
+			if i%2 == 1 {
+				contents, filename = failing, fmt.Sprintf("failing-%d.yaml", i)
+			}
+			_, err := Validate(context.Background(), Options{Source: filename, Contents: contents, Output: &outputs[i]})
+			require.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, out := range outputs {
+		if i%2 == 0 {
+			require.Contains(t, out.String(), "Success! - 2 relationships loaded, 2 assertions run, 1 expected relations validated")
+			require.NotContains(t, out.String(), "error:")
+			continue
+		}
+		require.Contains(t, out.String(), "error:")
+		require.Contains(t, out.String(), "object definition `document` not found")
+		require.NotContains(t, out.String(), "Success!")
+	}
+}
+
+func TestRenderErrorWithoutLine(t *testing.T) {
+	result := &Result{
+		Status:   StatusFailure,
+		File:     "test.yaml",
+		Errors:   []Diagnostic{{Message: "something is wrong"}},
+		contents: []byte("schema: |-\n  definition user {}\n"),
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, result, ColorNever))
+	require.Contains(t, out.String(), "something is wrong")
+	require.NotContains(t, out.String(), "schema:")
+	require.NotContains(t, out.String(), "-->")
+}
+
+func TestRenderErrorWithoutColumn(t *testing.T) {
+	result := &Result{
+		Status:   StatusFailure,
+		File:     "test.yaml",
+		Errors:   []Diagnostic{{Message: "something is wrong", Line: 2}, {Message: "something else", Line: 1, Column: 3}},
+		contents: []byte("schema: |-\n  definition user {}\n"),
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, Render(&out, result, ColorNever))
+	require.Contains(t, out.String(), " --> test.yaml:2\n")
+	require.Contains(t, out.String(), " --> test.yaml:1:3\n")
+}
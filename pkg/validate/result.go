@@ -0,0 +1,374 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	devinterface "github.com/authzed/spicedb/pkg/proto/developer/v1"
+	"github.com/authzed/spicedb/pkg/spiceerrors"
+	"github.com/authzed/spicedb/pkg/tuple"
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+)
+
+// Status is the overall outcome of a validation.
+type Status string
+
+const (
+	// StatusSuccess means every phase passed.
+	StatusSuccess Status = "success"
+
+	// StatusFailure means the document has errors, listed in Result.Errors.
+	StatusFailure Status = "failure"
+
+	// StatusError means validation could not be run at all, for example
+	// because the document could not be fetched.
+	StatusError Status = "error"
+)
+
+// Phase is one step of validating a document, in the order they run.
+type Phase string
+
+const (
+	// PhaseParse decodes the document.
+	PhaseParse Phase = "parse"
+
+	// PhaseRelationships checks that each relationship is well formed.
+	PhaseRelationships Phase = "relationships"
+
+	// PhaseSchema compiles the schema and loads the relationships against it.
+	PhaseSchema Phase = "schema"
+
+	// PhaseAssertions runs the assertTrue, assertCaveated and assertFalse
+	// assertions.
+	PhaseAssertions Phase = "assertions"
+
+	// PhaseExpectedRelations compares the expected relations (the
+	// validation block) against the computed ones.
+	PhaseExpectedRelations Phase = "expected_relations"
+)
+
+var phases = []Phase{PhaseParse, PhaseRelationships, PhaseSchema, PhaseAssertions, PhaseExpectedRelations}
+
+// PhaseStatus is the outcome of a single phase.
+type PhaseStatus string
+
+const (
+	PhasePassed  PhaseStatus = "passed"
+	PhaseFailed  PhaseStatus = "failed"
+	PhaseErrored PhaseStatus = "error"
+	PhaseSkipped PhaseStatus = "skipped"
+)
+
+// PhaseResult is the outcome of a single phase.
+type PhaseResult struct {
+	Phase  Phase       `json:"phase"`
+	Status PhaseStatus `json:"status"`
+}
+
+// Source is where in the document a diagnostic comes from.
+type Source string
+
+const (
+	SourceParse             Source = "parse"
+	SourceSchema            Source = "schema"
+	SourceRelationship      Source = "relationship"
+	SourceAssertion         Source = "assertion"
+	SourceExpectedRelations Source = "expected_relations"
+)
+
+// sourceContextLines is the number of lines shown before and after an error.
+const sourceContextLines = 3
+
+// Result is the structured outcome of validating a document.
+type Result struct {
+	Status Status `json:"status"`
+
+	// File is the source of the validated document.
+	File string `json:"file,omitempty"`
+
+	// Error holds the message when Status is StatusError.
+	Error string `json:"error,omitempty"`
+
+	// Stack is the stack trace of a panic validating the document, which is
+	// then reported as a CategoryInternal error.
+	Stack string `json:"stack,omitempty"`
+
+	// Category classifies the error, or the first diagnostic of the phase
+	// that failed. It is CategoryNone on success.
+	Category Category `json:"category,omitempty"`
+
+	// Phases holds the outcome of every phase, in the order they run.
+	Phases []PhaseResult `json:"phases"`
+
+	RelationshipsLoaded        int `json:"relationshipsLoaded"`
+	AssertionsRun              int `json:"assertionsRun"`
+	CaveatedAssertionsRun      int `json:"caveatedAssertionsRun"`
+	ExpectedRelationsValidated int `json:"expectedRelationsValidated"`
+
+	// AssertionsSkipped and ExpectedRelationsSkipped count those left out
+	// because they depend on a relationship dropped with Options.KeepGoing.
+	// A phase whose every item was left out is reported as skipped.
+	AssertionsSkipped        int `json:"assertionsSkipped,omitempty"`
+	ExpectedRelationsSkipped int `json:"expectedRelationsSkipped,omitempty"`
+
+	// Assertions holds the outcome of every assertion, in the order they
+	// run: assertTrue, assertCaveated, then assertFalse.
+	Assertions []AssertionResult `json:"assertions"`
+
+	Errors []Diagnostic `json:"errors"`
+
+	// contents is the raw document, kept for rendering errors with source.
+	contents []byte
+
+	// referenced holds the raw files the document referenced, by source,
+	// for rendering the errors that lie in them.
+	referenced map[string][]byte
+}
+
+// Diagnostic is a single problem found in the document.
+type Diagnostic struct {
+	Source  Source `json:"source"`
+	Kind    string `json:"kind,omitempty"`
+	Message string `json:"message"`
+
+	Category Category `json:"category"`
+
+	// Line and Column are 1-indexed, or zero when unknown.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+
+	// Context is the text the error refers to, highlighted when rendered.
+	Context string `json:"context,omitempty"`
+
+	// File is the file the error lies in when it is one the document
+	// referenced, such as its schemaFile, and empty when it is the document
+	// itself. Line, Column and SourceLines are then those of that file.
+	File string `json:"file,omitempty"`
+
+	// SourceLines are the lines of the document surrounding the error.
+	SourceLines []SourceLine `json:"sourceLines,omitempty"`
+
+	// CheckTrace is the resolved check trace of a failed assertion, if any.
+	CheckTrace *v1.CheckDebugTrace `json:"-"`
+}
+
+// SourceLine is one line of the document surrounding an error.
+type SourceLine struct {
+	Line      int    `json:"line"`
+	Text      string `json:"text"`
+	Highlight bool   `json:"highlight,omitempty"`
+}
+
+// NewResult returns a successful result with every phase skipped.
+func NewResult(file string) *Result {
+	result := &Result{Status: StatusSuccess, File: file, Assertions: []AssertionResult{}, Errors: []Diagnostic{}}
+	for _, phase := range phases {
+		result.Phases = append(result.Phases, PhaseResult{Phase: phase, Status: PhaseSkipped})
+	}
+	return result
+}
+
+// Fail marks the result as not having been run to completion because of err.
+func (r *Result) Fail(err error) *Result {
+	r.Status = StatusError
+	r.Error = err.Error()
+	r.Category = CategoryOf(err)
+	return r
+}
+
+// Err returns the error the result failed with, if any.
+func (r *Result) Err() error {
+	if r.Status != StatusError {
+		return nil
+	}
+	return &Error{Category: r.Category, Err: errors.New(r.Error)}
+}
+
+// clone returns a copy of the result that can be added to without changing
+// the original.
+func (r *Result) clone() *Result {
+	clone := *r
+	clone.Phases = slices.Clone(r.Phases)
+	clone.Assertions = slices.Clone(r.Assertions)
+	clone.Errors = slices.Clone(r.Errors)
+	return &clone
+}
+
+// Phase returns the outcome of the given phase.
+func (r *Result) Phase(phase Phase) PhaseStatus {
+	for _, p := range r.Phases {
+		if p.Phase == phase {
+			return p.Status
+		}
+	}
+	return PhaseSkipped
+}
+
+func (r *Result) setPhase(phase Phase, status PhaseStatus) {
+	for i := range r.Phases {
+		if r.Phases[i].Phase == phase {
+			r.Phases[i].Status = status
+		}
+	}
+}
+
+// failPhase records that the phase could not be run because of err.
+func (r *Result) failPhase(phase Phase, err error) *Result {
+	r.setPhase(phase, PhaseErrored)
+	return r.Fail(err)
+}
+
+// addReferenced keeps the contents of a file the document referenced.
+func (r *Result) addReferenced(source string, contents []byte) {
+	if r.referenced == nil {
+		r.referenced = map[string][]byte{}
+	}
+	r.referenced[source] = contents
+}
+
+// inFile records that the errors from the given index on lie in the file,
+// if it is not the document itself.
+func (r *Result) inFile(errorsBefore int, file string) {
+	if file == "" {
+		return
+	}
+	for i := errorsBefore; i < len(r.Errors); i++ {
+		r.Errors[i].File = file
+	}
+}
+
+// endPhase records the outcome of a phase that ran, from whether it added
+// any errors, and reports whether it passed.
+func (r *Result) endPhase(phase Phase, errorsBefore int) bool {
+	if len(r.Errors) > errorsBefore {
+		r.Status = StatusFailure
+		if r.Category == CategoryNone {
+			r.Category = r.Errors[errorsBefore].Category
+		}
+		r.setPhase(phase, PhaseFailed)
+		return false
+	}
+	r.setPhase(phase, PhasePassed)
+	return true
+}
+
+func (r *Result) addErrorWithSource(lines []string, errWithSource *spiceerrors.ErrorWithSource) {
+	r.Errors = append(r.Errors, Diagnostic{
+		Source:      SourceParse,
+		Message:     errWithSource.Error(),
+		Category:    CategoryYAMLSyntax,
+		Line:        int(errWithSource.LineNumber),
+		Column:      int(errWithSource.ColumnPosition),
+		Context:     errWithSource.SourceCodeString,
+		SourceLines: sourceLinesAround(lines, int(errWithSource.LineNumber)),
+	})
+}
+
+// addSyntaxError adds an error unmarshalling the document. YAML only reports
+// the line of an error, so it points at the start of that line's content.
+func (r *Result) addSyntaxError(lines []string, syntaxErr *decode.SyntaxError) {
+	r.Errors = append(r.Errors, Diagnostic{
+		Source:      SourceParse,
+		Message:     syntaxErr.Error(),
+		Category:    CategoryYAMLSyntax,
+		Line:        syntaxErr.Line,
+		Column:      contentColumn(lines, syntaxErr.Line),
+		SourceLines: sourceLinesAround(lines, syntaxErr.Line),
+	})
+}
+
+func (r *Result) addRelationshipError(lines []string, rel *v1.Relationship, err error) {
+	relString := tuple.StringRelationshipWithoutCaveat(rel)
+	line := lineContaining(lines, relString)
+	r.Errors = append(r.Errors, Diagnostic{
+		Source:      SourceRelationship,
+		Kind:        strings.ToLower(devinterface.DeveloperError_PARSE_ERROR.String()),
+		Message:     fmt.Sprintf("invalid relationship `%s`: %s", relString, err),
+		Category:    CategoryRelationship,
+		Line:        line,
+		Context:     relString,
+		SourceLines: sourceLinesAround(lines, line),
+	})
+}
+
+func (r *Result) addDeveloperErrors(lines []string, devErrors []*devinterface.DeveloperError, lineOffset int) {
+	for _, devErr := range devErrors {
+		line := int(devErr.Line)
+		switch {
+		case line > 0:
+			line += lineOffset
+		case devErr.Source == devinterface.DeveloperError_RELATIONSHIP && devErr.Context != "":
+			// Relationships that do not fit the schema come without a line,
+			// but with the relationship itself.
+			line = lineContaining(lines, devErr.Context)
+		}
+
+		var checkTrace *v1.CheckDebugTrace
+		if devErr.CheckResolvedDebugInformation != nil {
+			checkTrace = devErr.CheckResolvedDebugInformation.Check
+		}
+
+		r.Errors = append(r.Errors, Diagnostic{
+			Source:      developerErrorSource(devErr.Source),
+			Kind:        strings.ToLower(devErr.Kind.String()),
+			Message:     devErr.Message,
+			Category:    developerErrorCategory(devErr),
+			Line:        line,
+			Column:      int(devErr.Column),
+			Context:     devErr.Context,
+			SourceLines: sourceLinesAround(lines, line),
+			CheckTrace:  checkTrace,
+		})
+	}
+}
+
+func developerErrorSource(source devinterface.DeveloperError_Source) Source {
+	switch source {
+	case devinterface.DeveloperError_VALIDATION_YAML:
+		return SourceExpectedRelations
+	default:
+		return Source(strings.ToLower(source.String()))
+	}
+}
+
+// lineContaining returns the 1-indexed number of the first line containing
+// the given text, or 0 if there is none.
+func lineContaining(lines []string, text string) int {
+	for i, line := range lines {
+		if strings.Contains(line, text) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// contentColumn returns the 1-indexed column the content of the given
+// 1-indexed line starts at, or 0 if the line is unknown.
+func contentColumn(lines []string, lineNumber int) int {
+	if lineNumber <= 0 || lineNumber > len(lines) {
+		return 0
+	}
+	line := lines[lineNumber-1]
+	return len(line) - len(strings.TrimLeft(line, " \t")) + 1
+}
+
+// sourceLinesAround returns the lines surrounding the given 1-indexed line, or
+// nothing if the line is unknown.
+func sourceLinesAround(lines []string, lineNumber int) []SourceLine {
+	if lineNumber <= 0 {
+		return nil
+	}
+
+	errorLineIndex := lineNumber - 1
+	var found []SourceLine
+	for i := errorLineIndex - sourceContextLines; i < errorLineIndex+sourceContextLines; i++ {
+		if i < 0 || i >= len(lines) {
+			continue
+		}
+		found = append(found, SourceLine{Line: i + 1, Text: lines[i], Highlight: i == errorLineIndex})
+	}
+	return found
+}
@@ -0,0 +1,104 @@
+// Package validate validates SpiceDB validation documents (the YAML files
+// read by `zed validate`) and runs checks, expansions and lookups against
+// them.
+package validate
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+)
+
+// ColorMode controls whether rendered output is colored.
+type ColorMode int
+
+const (
+	// ColorAuto colors output when the process runs in a terminal that
+	// supports it.
+	ColorAuto ColorMode = iota
+
+	// ColorAlways colors output regardless of the terminal.
+	ColorAlways
+
+	// ColorNever never colors output.
+	ColorNever
+)
+
+// Options describe a document and how to validate it.
+type Options struct {
+	// Source identifies the document. It is the URL (or path) the document
+	// is fetched from, unless Contents or Decoder is set, in which case it
+	// only names the document in results.
+	Source string
+
+	// Contents, when not nil, is the document itself.
+	Contents []byte
+
+	// Decoder, when set, decodes the document in place of Source and
+	// Contents.
+	Decoder decode.Func
+
+	// HTTP configures how the document, and any files it references, are
+	// fetched over HTTP.
+	HTTP decode.HTTPOptions
+
+	// Output, when set, receives the human-readable rendering of the
+	// result.
+	Output io.Writer
+
+	// Color controls whether the rendering written to Output is colored.
+	Color ColorMode
+
+	// FailFast stops validation at the first phase that fails. Otherwise,
+	// the expected relations are still validated when assertions fail.
+	FailFast bool
+
+	// KeepGoing goes on past relationships that are invalid or do not fit
+	// the schema, leaving them out, so that a single run reports as many
+	// errors as possible. Assertions and expected relations whose relation
+	// or permission reaches the relation of a left out relationship are
+	// skipped. FailFast takes precedence.
+	KeepGoing bool
+}
+
+func (o Options) decoder() (decode.Func, error) {
+	switch {
+	case o.Decoder != nil:
+		return o.Decoder, nil
+	case o.Contents != nil:
+		return decode.BytesDecoderWithOptions(o.Contents, o.HTTP), nil
+	}
+
+	u, err := url.Parse(o.Source)
+	if err != nil {
+		return nil, err
+	}
+	return decode.DecoderForURLWithOptions(u, o.HTTP)
+}
+
+// Validate loads the document described by the options and runs every phase
+// against it. The result is also rendered to opts.Output when it is set.
+//
+// The returned error is that of the result, set when validation could not
+// be run at all, or else any error writing to opts.Output. A document with
+// errors is not an error: see Result.Status.
+func Validate(ctx context.Context, opts Options) (*Result, error) {
+	doc, result := Load(ctx, opts)
+	if doc != nil {
+		result = doc.validate(ctx, result)
+		doc.Close()
+	}
+
+	if err := result.Err(); err != nil {
+		return result, err
+	}
+
+	if opts.Output != nil {
+		if err := Render(opts.Output, result, opts.Color); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
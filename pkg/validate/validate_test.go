@@ -0,0 +1,546 @@
+package validate
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
+	devinterface "github.com/authzed/spicedb/pkg/proto/developer/v1"
+	"github.com/authzed/spicedb/pkg/tuple"
+	"github.com/authzed/spicedb/pkg/validationfile"
+	"github.com/leetrout/python-spicedb-validation/pkg/decode"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const testDocument = `schema: |-
+  definition user {}
+
+  definition document {
+    relation viewer: user
+    relation editor: user
+    permission view = viewer + editor
+  }
+relationships: |-
+  document:plan#viewer@user:alice
+  document:plan#editor@user:bob
+assertions:
+  assertTrue:
+    - document:plan#view@user:alice
+  assertFalse:
+    - document:plan#view@user:carol
+validation:
+  document:plan#view:
+    - "[user:alice] is <document:plan#viewer>"
+    - "[user:bob] is <document:plan#editor>"
+`
+
+const testFailingDocument = `schema: |-
+  definition user {}
+
+  definition document {
+    relation viewer: user
+    permission view = viewer
+  }
+relationships: |-
+  document:plan#viewer@user:alice
+assertions:
+  assertTrue:
+    - document:plan#view@user:carol
+validation:
+  document:plan#view:
+    - "[user:carol] is <document:plan#viewer>"
+`
+
+const testCaveatedDocument = `schema: |-
+  definition user {}
+
+  caveat on_network(allowed string, network string) {
+    network == allowed
+  }
+
+  definition document {
+    relation viewer: user | user with on_network
+    permission view = viewer
+  }
+relationships: |-
+  document:plan#viewer@user:alice
+  document:plan#viewer@user:bob[on_network:{"allowed":"office"}]
+assertions:
+  assertTrue:
+    - document:plan#view@user:alice
+    - 'document:plan#view@user:bob with {"network": "office"}'
+  assertCaveated:
+    - document:plan#view@user:bob
+`
+
+func phaseStatuses(result *Result) map[Phase]PhaseStatus {
+	statuses := map[Phase]PhaseStatus{}
+	for _, p := range result.Phases {
+		statuses[p.Phase] = p.Status
+	}
+	return statuses
+}
+
+func TestValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testDocument), 0o600))
+
+	var out bytes.Buffer
+	result, err := Validate(context.Background(), Options{Source: path, Output: &out, Color: ColorNever})
+	require.NoError(t, err)
+	require.Equal(t, StatusSuccess, result.Status)
+	require.Equal(t, path, result.File)
+	require.Equal(t, 2, result.RelationshipsLoaded)
+	require.Equal(t, 2, result.AssertionsRun)
+	require.Equal(t, 1, result.ExpectedRelationsValidated)
+	require.Empty(t, result.Errors)
+	for _, phase := range phases {
+		require.Equal(t, PhasePassed, result.Phase(phase), phase)
+	}
+	require.Equal(t, "Success! - 2 relationships loaded, 2 assertions run, 1 expected relations validated\n", out.String())
+}
+
+func TestValidateFailFast(t *testing.T) {
+	result, err := Validate(context.Background(), Options{Source: "failing.yaml", Contents: []byte(testFailingDocument)})
+	require.NoError(t, err)
+	require.Equal(t, StatusFailure, result.Status)
+	require.Equal(t, PhaseFailed, result.Phase(PhaseAssertions))
+	require.Equal(t, PhaseFailed, result.Phase(PhaseExpectedRelations))
+	require.Len(t, result.Errors, 3)
+	require.Equal(t, SourceAssertion, result.Errors[0].Source)
+	require.NotNil(t, result.Errors[0].CheckTrace)
+	require.Equal(t, SourceExpectedRelations, result.Errors[1].Source)
+
+	result, err = Validate(context.Background(), Options{Source: "failing.yaml", Contents: []byte(testFailingDocument), FailFast: true})
+	require.NoError(t, err)
+	require.Equal(t, StatusFailure, result.Status)
+	require.Equal(t, PhaseFailed, result.Phase(PhaseAssertions))
+	require.Equal(t, PhaseSkipped, result.Phase(PhaseExpectedRelations))
+	require.Len(t, result.Errors, 1)
+}
+
+func TestValidateAssertions(t *testing.T) {
+	result, err := Validate(context.Background(), Options{Source: "test.yaml", Contents: []byte(testDocument)})
+	require.NoError(t, err)
+	require.Len(t, result.Assertions, 2)
+
+	assertTrue := result.Assertions[0]
+	require.Equal(t, AssertTrue, assertTrue.Kind)
+	require.Equal(t, "document:plan#view@user:alice", assertTrue.Relationship)
+	require.Equal(t, 14, assertTrue.Line)
+	require.True(t, assertTrue.Passed)
+	require.Equal(t, "has_permission", assertTrue.Permissionship)
+	require.Positive(t, assertTrue.DurationMs)
+	require.Empty(t, assertTrue.Trace)
+
+	assertFalse := result.Assertions[1]
+	require.Equal(t, AssertFalse, assertFalse.Kind)
+	require.Equal(t, 16, assertFalse.Line)
+	require.True(t, assertFalse.Passed)
+	require.Equal(t, "no_permission", assertFalse.Permissionship)
+
+	result, err = Validate(context.Background(), Options{Source: "failing.yaml", Contents: []byte(testFailingDocument)})
+	require.NoError(t, err)
+	require.Len(t, result.Assertions, 1)
+
+	failed := result.Assertions[0]
+	require.False(t, failed.Passed)
+	require.Equal(t, "no_permission", failed.Permissionship)
+	require.Equal(t, result.Errors[0].Message, failed.Message)
+	require.Equal(t, result.Errors[0].Line, failed.Line)
+	require.NotEmpty(t, failed.Trace)
+	require.Contains(t, failed.TraceText, "viewer")
+}
+
+func TestValidateAssertionTraceText(t *testing.T) {
+	var out bytes.Buffer
+	result, err := Validate(context.Background(), Options{Source: "failing.yaml", Contents: []byte(testFailingDocument), Output: &out, Color: ColorAlways})
+	require.NoError(t, err)
+	require.Contains(t, out.String(), "\x1b[")
+
+	require.Len(t, result.Assertions, 1)
+	require.False(t, result.Assertions[0].Passed)
+	require.Contains(t, result.Assertions[0].TraceText, "viewer")
+	require.NotContains(t, result.Assertions[0].TraceText, "\x1b")
+}
+
+func TestValidateCaveatedAssertions(t *testing.T) {
+	var out bytes.Buffer
+	result, err := Validate(context.Background(), Options{Source: "caveated.yaml", Contents: []byte(testCaveatedDocument), Output: &out, Color: ColorNever})
+	require.NoError(t, err)
+	require.Equal(t, StatusSuccess, result.Status, result.Errors)
+	require.Equal(t, 3, result.AssertionsRun)
+	require.Equal(t, 2, result.CaveatedAssertionsRun)
+	require.Contains(t, out.String(), "3 assertions run (2 caveated)")
+
+	require.False(t, result.Assertions[0].Caveated())
+
+	withContext := result.Assertions[1]
+	require.Equal(t, AssertTrue, withContext.Kind)
+	require.Equal(t, map[string]any{"network": "office"}, withContext.Context)
+	require.Equal(t, []CaveatEvaluation{{
+		Name:       "on_network",
+		Expression: "network == allowed",
+		Result:     "true",
+		Context:    map[string]any{"allowed": "office", "network": "office"},
+	}}, withContext.Caveats)
+
+	conditional := result.Assertions[2]
+	require.Equal(t, AssertCaveated, conditional.Kind)
+	require.True(t, conditional.Passed)
+	require.Equal(t, "conditional_permission", conditional.Permissionship)
+	require.Equal(t, []string{"network"}, conditional.MissingContext)
+	require.Len(t, conditional.Caveats, 1)
+	require.Equal(t, "missing_some_context", conditional.Caveats[0].Result)
+	require.Equal(t, []string{"network"}, conditional.Caveats[0].MissingContext)
+}
+
+const testBrokenDocument = `schema: |-
+  definition user {}
+  definition folder {}
+
+  definition document {
+    relation viewer: user
+    permission view = viewer
+  }
+relationships: |-
+  document:plan#viewer@user:alice
+  document:spec#viewer@folder:x
+assertions:
+  assertTrue:
+    - document:plan#view@user:alice
+    - document:spec#view@user:bob
+  assertFalse:
+    - document:plan#view@user:alice
+validation:
+  document:plan#view:
+    - "[user:carol] is <document:plan#viewer>"
+  document:spec#view: []
+`
+
+func TestValidateKeepGoing(t *testing.T) {
+	result, err := Validate(context.Background(), Options{Source: "broken.yaml", Contents: []byte(testBrokenDocument)})
+	require.NoError(t, err)
+	require.Equal(t, StatusFailure, result.Status)
+	require.Equal(t, PhaseFailed, result.Phase(PhaseSchema))
+	require.Equal(t, PhaseSkipped, result.Phase(PhaseAssertions))
+	require.Len(t, result.Errors, 1)
+
+	result, err = Validate(context.Background(), Options{Source: "broken.yaml", Contents: []byte(testBrokenDocument), KeepGoing: true})
+	require.NoError(t, err)
+	require.Equal(t, StatusFailure, result.Status)
+	require.Equal(t, CategoryRelationship, result.Category)
+	require.Equal(t, map[Phase]PhaseStatus{
+		PhaseParse:             PhasePassed,
+		PhaseRelationships:     PhasePassed,
+		PhaseSchema:            PhaseFailed,
+		PhaseAssertions:        PhaseFailed,
+		PhaseExpectedRelations: PhaseFailed,
+	}, phaseStatuses(result))
+	require.Equal(t, 1, result.RelationshipsLoaded)
+
+	require.Equal(t, 2, result.AssertionsRun)
+	require.Equal(t, 1, result.AssertionsSkipped)
+	require.True(t, result.Assertions[0].Passed)
+	require.True(t, result.Assertions[1].Skipped)
+	require.Contains(t, result.Assertions[1].Message, "document:spec#viewer@folder:x")
+	require.False(t, result.Assertions[2].Passed)
+
+	require.Equal(t, 1, result.ExpectedRelationsValidated)
+	require.Equal(t, 1, result.ExpectedRelationsSkipped)
+
+	categories := map[Category]int{}
+	for _, diag := range result.Errors {
+		categories[diag.Category]++
+	}
+	require.Equal(t, 1, categories[CategoryRelationship])
+	require.Equal(t, 1, categories[CategoryAssertion])
+	require.Positive(t, categories[CategoryExpectedRelations])
+
+	// A loaded document reports the errors found while loading it.
+	doc, loaded := Load(context.Background(), Options{Source: "broken.yaml", Contents: []byte(testBrokenDocument), KeepGoing: true})
+	require.NotNil(t, doc)
+	defer doc.Close()
+	require.Equal(t, StatusFailure, loaded.Status)
+	validated := doc.Validate(context.Background())
+	require.Equal(t, len(result.Errors), len(validated.Errors))
+	require.Equal(t, PhaseFailed, validated.Phase(PhaseSchema))
+	require.Len(t, doc.Validate(context.Background()).Errors, len(result.Errors))
+
+	// A broken schema still stops validation.
+	doc, loaded = Load(context.Background(), Options{Source: "bad.yaml", Contents: []byte("schema: |-\n  definition user {\n    relation viewer: group\n  }\n"), KeepGoing: true})
+	require.Nil(t, doc)
+	require.Equal(t, CategorySchema, loaded.Category)
+}
+
+func TestValidateKeepGoingSkipsAffected(t *testing.T) {
+	const document = `schema: |-
+  definition user {}
+  definition folder {
+    relation viewer: user
+  }
+
+  definition document {
+    relation parent: folder
+    relation viewer: user
+    relation editor: user
+    permission view = viewer + editor + parent->viewer
+    permission edit = editor
+  }
+relationships: |-
+  document:plan#viewer@folder:x
+  document:plan#editor@user:alice
+assertions:
+  assertTrue:
+    - document:plan#edit@user:alice
+    - document:plan#view@user:alice
+  assertFalse:
+    - document:plan#edit@folder:x
+validation:
+  document:plan#edit:
+    - "[user:alice] is <document:plan#editor>"
+  document:plan#view: []
+`
+	result, err := Validate(context.Background(), Options{Source: "plan.yaml", Contents: []byte(document), KeepGoing: true})
+	require.NoError(t, err)
+	require.Equal(t, 2, result.AssertionsRun)
+	require.Equal(t, 1, result.AssertionsSkipped)
+	require.True(t, result.Assertions[0].Passed)
+	require.True(t, result.Assertions[1].Skipped)
+	require.True(t, result.Assertions[2].Passed)
+	require.Equal(t, 1, result.ExpectedRelationsValidated)
+	require.Equal(t, 1, result.ExpectedRelationsSkipped)
+	require.Equal(t, PhasePassed, result.Phase(PhaseAssertions))
+	require.Equal(t, PhasePassed, result.Phase(PhaseExpectedRelations))
+
+	// A relation reached through an arrow matches relationships of any
+	// object, and a phase whose every item is skipped is reported so.
+	const arrow = `schema: |-
+  definition user {}
+  definition folder {
+    relation viewer: user
+  }
+
+  definition document {
+    relation parent: folder
+    permission view = parent->viewer
+  }
+relationships: |-
+  folder:x#viewer@user:alice#member
+  document:plan#parent@folder:y
+assertions:
+  assertFalse:
+    - document:plan#view@user:alice
+validation:
+  document:plan#view: []
+`
+	result, err = Validate(context.Background(), Options{Source: "arrow.yaml", Contents: []byte(arrow), KeepGoing: true})
+	require.NoError(t, err)
+	require.Equal(t, 0, result.AssertionsRun)
+	require.Equal(t, 1, result.AssertionsSkipped)
+	require.Equal(t, 1, result.ExpectedRelationsSkipped)
+	require.Equal(t, PhaseSkipped, result.Phase(PhaseAssertions))
+	require.Equal(t, PhaseSkipped, result.Phase(PhaseExpectedRelations))
+}
+
+func TestValidateMalformedTuples(t *testing.T) {
+	// An assertion the decoder let through without a resource is reported,
+	// not panicked on.
+	decoder := func(ctx context.Context, out interface{}) ([]byte, error) {
+		contents, err := decode.BytesDecoder([]byte(testDocument))(ctx, out)
+		parsed := out.(*validationfile.ValidationFile)
+		parsed.Assertions.AssertTrue[0].Relationship.Resource.ObjectId = ""
+		return contents, err
+	}
+	result, err := Validate(context.Background(), Options{Source: "test.yaml", Decoder: decoder})
+	require.NoError(t, err)
+	require.Equal(t, StatusFailure, result.Status)
+	require.Equal(t, CategoryAssertion, result.Category)
+	require.Contains(t, result.Assertions[0].Message, "invalid assertion relationship")
+
+	// A relationship whose caveat context cannot be written out is an error.
+	tpl := tuple.MustParse("document:plan#viewer@user:alice")
+	tpl.Caveat = &core.ContextualizedCaveat{CaveatName: "unknown", Context: &structpb.Struct{Fields: map[string]*structpb.Value{
+		"ratio": structpb.NewNumberValue(math.NaN()),
+	}}}
+	_, _, err = rejectedTuples([]*core.RelationTuple{tpl}, []*devinterface.DeveloperError{{Source: devinterface.DeveloperError_RELATIONSHIP, Context: "document:plan#viewer@user:alice"}})
+	require.Error(t, err)
+	require.Error(t, droppedRelationships{}.addTuple(tpl))
+}
+
+func TestValidateLoadFailures(t *testing.T) {
+	result, err := Validate(context.Background(), Options{Source: "bad.yaml", Contents: []byte("schema: |-\n  definition user {\n")})
+	require.NoError(t, err)
+	require.Equal(t, StatusFailure, result.Status)
+	require.Equal(t, map[Phase]PhaseStatus{
+		PhaseParse:             PhaseFailed,
+		PhaseRelationships:     PhaseSkipped,
+		PhaseSchema:            PhaseSkipped,
+		PhaseAssertions:        PhaseSkipped,
+		PhaseExpectedRelations: PhaseSkipped,
+	}, phaseStatuses(result))
+
+	// A document that is not valid YAML points at the offending line.
+	result, err = Validate(context.Background(), Options{Source: "bad.yaml", Contents: []byte("schema: |-\n  definition user {}\nrelationships: [\n")})
+	require.NoError(t, err)
+	require.Equal(t, StatusFailure, result.Status)
+	require.Equal(t, CategoryYAMLSyntax, result.Category)
+	require.Equal(t, PhaseFailed, result.Phase(PhaseParse))
+	require.Len(t, result.Errors, 1)
+	require.Equal(t, SourceParse, result.Errors[0].Source)
+	require.Equal(t, 3, result.Errors[0].Line)
+	require.Equal(t, 1, result.Errors[0].Column)
+	require.NotEmpty(t, result.Errors[0].SourceLines)
+
+	result, err = Validate(context.Background(), Options{Source: "ftp://example.com/doc.yaml"})
+	require.Error(t, err)
+	require.Equal(t, StatusError, result.Status)
+	require.Equal(t, PhaseErrored, result.Phase(PhaseParse))
+
+	result, err = Validate(context.Background(), Options{Source: filepath.Join(t.TempDir(), "missing.yaml")})
+	require.Error(t, err)
+	require.Equal(t, StatusError, result.Status)
+}
+
+func TestValidateReferences(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+		return path
+	}
+	write("schema.zed", "definition user {}\n\ndefinition document {\n  relation viewer: user\n  permission view = viewer\n}\n")
+	write("relationships.txt", "document:plan#viewer@user:alice\n")
+	write("broken.zed", "definition user {}\n\ndefinition document {\n  relation viewer: group\n}\n")
+	write("unknown.txt", "// fixtures\ndocument:plan#editor@user:alice\n")
+
+	valid := write("valid.yaml", "schemaFile: schema.zed\nrelationshipsFile: relationships.txt\nassertions:\n  assertTrue:\n    - document:plan#view@user:alice\n")
+	result, err := Validate(context.Background(), Options{Source: valid})
+	require.NoError(t, err)
+	require.Equal(t, StatusSuccess, result.Status, result.Errors)
+	require.Equal(t, 1, result.RelationshipsLoaded)
+	require.Equal(t, 1, result.AssertionsRun)
+
+	broken := write("broken.yaml", "schemaFile: broken.zed\n")
+	var out bytes.Buffer
+	result, err = Validate(context.Background(), Options{Source: broken, Output: &out, Color: ColorNever})
+	require.NoError(t, err)
+	require.Equal(t, CategorySchema, result.Category)
+	require.Len(t, result.Errors, 1)
+	require.Equal(t, filepath.Join(dir, "broken.zed"), result.Errors[0].File)
+	require.Equal(t, 4, result.Errors[0].Line)
+	require.Contains(t, out.String(), " --> "+filepath.Join(dir, "broken.zed")+":4:")
+	require.Contains(t, out.String(), "relation viewer: group")
+
+	unknown := write("unknown.yaml", "schemaFile: schema.zed\nrelationshipsFile: unknown.txt\n")
+	result, err = Validate(context.Background(), Options{Source: unknown})
+	require.NoError(t, err)
+	require.Equal(t, CategoryRelationship, result.Category)
+	require.Equal(t, filepath.Join(dir, "unknown.txt"), result.Errors[0].File)
+
+	missing := write("missing.yaml", "schemaFile: missing.zed\n")
+	result, err = Validate(context.Background(), Options{Source: missing})
+	require.ErrorContains(t, err, "schemaFile "+filepath.Join(dir, "missing.zed"))
+	require.Equal(t, CategoryDecode, result.Category)
+
+	write("invalid.yaml", "relationships: |-\n  document:plan#viewer@user:alice\nschema: [\n")
+	invalid := write("invalid-ref.yaml", "schemaFile: invalid.yaml\n")
+	result, err = Validate(context.Background(), Options{Source: invalid})
+	require.NoError(t, err)
+	require.Equal(t, StatusFailure, result.Status)
+	require.Equal(t, CategoryYAMLSyntax, result.Category)
+	require.Equal(t, filepath.Join(dir, "invalid.yaml"), result.Errors[0].File)
+	require.Equal(t, 3, result.Errors[0].Line)
+}
+
+// testDownload is testFailingDocument as the Playground downloads it.
+const testDownload = `schema: |-
+    definition user {}
+
+    definition document {
+      relation viewer: user
+      permission view = viewer
+    }
+relationships: |-
+    document:plan#viewer@user:alice
+assertions: |
+    assertTrue:
+      - document:plan#view@user:carol
+validation: |
+    document:plan#view:
+      - "[user:carol] is <document:plan#viewer>"
+`
+
+func TestValidatePlaygroundDownload(t *testing.T) {
+	result, err := Validate(context.Background(), Options{Source: "download.yaml", Contents: []byte(testDownload)})
+	require.NoError(t, err)
+	require.Equal(t, StatusFailure, result.Status)
+	require.Equal(t, 1, result.RelationshipsLoaded)
+	require.Equal(t, 1, result.AssertionsRun)
+	require.Equal(t, 12, result.Assertions[0].Line)
+	require.Equal(t, SourceAssertion, result.Errors[0].Source)
+	require.Equal(t, 12, result.Errors[0].Line)
+	require.Equal(t, SourceExpectedRelations, result.Errors[1].Source)
+	require.Equal(t, 15, result.Errors[1].Line)
+
+	invalid := strings.Replace(testDownload, "user:alice", "user:alice#", 1)
+	result, err = Validate(context.Background(), Options{Source: "download.yaml", Contents: []byte(invalid), KeepGoing: true})
+	require.NoError(t, err)
+	require.Equal(t, CategoryYAMLSyntax, result.Category)
+	require.Equal(t, 9, result.Errors[0].Line)
+}
+
+func TestRenderColor(t *testing.T) {
+	result, err := Validate(context.Background(), Options{Source: "failing.yaml", Contents: []byte(testFailingDocument)})
+	require.NoError(t, err)
+
+	var never, always bytes.Buffer
+	require.NoError(t, Render(&never, result, ColorNever))
+	require.NoError(t, Render(&always, result, ColorAlways))
+
+	require.NotContains(t, never.String(), "\x1b[")
+	require.Contains(t, never.String(), "Explanation:")
+	require.Contains(t, never.String(), " --> failing.yaml:")
+	require.Contains(t, always.String(), "\x1b[")
+
+	_, trace, ok := strings.Cut(always.String(), "Explanation:")
+	require.True(t, ok)
+	require.Contains(t, trace, "\x1b[")
+}
+
+func TestDocumentClose(t *testing.T) {
+	doc, result := Load(context.Background(), Options{Source: "test.yaml", Contents: []byte(testDocument)})
+	require.NotNil(t, doc, result.Errors)
+
+	require.Equal(t, StatusSuccess, doc.Validate(context.Background()).Status)
+
+	doc.Close()
+	doc.Close()
+	result = doc.Validate(context.Background())
+	require.Equal(t, StatusError, result.Status)
+	require.Equal(t, ErrClosed.Error(), result.Error)
+
+	_, err := doc.Check(context.Background(), "document:plan", "view", "user:alice", nil)
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestValidateRelationshipErrorLine(t *testing.T) {
+	contents := "schema: |-\n  definition user {}\nrelationships: |-\n  user:alice#viewer@user:bob\n"
+	var out bytes.Buffer
+	result, err := Validate(context.Background(), Options{Source: "test.yaml", Contents: []byte(contents), Output: &out, Color: ColorNever})
+	require.NoError(t, err)
+	require.Len(t, result.Errors, 1)
+
+	relErr := result.Errors[0]
+	require.Equal(t, CategoryRelationship, relErr.Category)
+	require.Equal(t, 4, relErr.Line)
+	require.Contains(t, relErr.SourceLines, SourceLine{Line: 4, Text: "  user:alice#viewer@user:bob", Highlight: true})
+	require.Contains(t, out.String(), " --> test.yaml:4\n")
+	require.Contains(t, out.String(), "4 >   user:alice#viewer@user:bob")
+}
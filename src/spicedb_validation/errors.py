@@ -0,0 +1,113 @@
+"""Exceptions for the failure categories reported by the library.
+
+Every failed result carries a `category` of the form `{"code": 7, "name":
+"invalid_argument"}`. raise_for_result turns such a result into an exception,
+so that callers can tell a broken document (DocumentError) apart from a
+permission model that does not behave as the document says (ModelError).
+
+This module does not load the shared library, so it can be used with the
+worker as well.
+"""
+
+
+class SpiceDBValidationError(Exception):
+    """Base class of the exceptions raised for failed results."""
+
+    code = 9
+    name = "internal_error"
+
+    def __init__(self, message: str, result: dict | None = None):
+        super().__init__(message)
+        self.result = result
+
+
+class DocumentError(SpiceDBValidationError):
+    """The document is broken: it cannot be read, parsed or loaded."""
+
+
+class DecodeError(DocumentError):
+    code = 1
+    name = "decode_error"
+
+
+class YAMLSyntaxError(DocumentError):
+    code = 2
+    name = "yaml_syntax_error"
+
+
+class SchemaError(DocumentError):
+    code = 3
+    name = "schema_error"
+
+
+class RelationshipError(DocumentError):
+    code = 4
+    name = "relationship_error"
+
+
+class ModelError(SpiceDBValidationError):
+    """The document loaded, but the permission model does not behave as it
+    says."""
+
+
+class AssertionFailure(ModelError):
+    code = 5
+    name = "assertion_failure"
+
+
+class ExpectedRelationsMismatch(ModelError):
+    code = 6
+    name = "expected_relations_mismatch"
+
+
+class InvalidArgumentError(SpiceDBValidationError):
+    code = 7
+    name = "invalid_argument"
+
+
+class CanceledError(SpiceDBValidationError):
+    code = 8
+    name = "canceled"
+
+
+class InternalError(SpiceDBValidationError):
+    code = 9
+    name = "internal_error"
+
+
+_BY_CODE = {
+    cls.code: cls
+    for cls in (
+        DecodeError,
+        YAMLSyntaxError,
+        SchemaError,
+        RelationshipError,
+        AssertionFailure,
+        ExpectedRelationsMismatch,
+        InvalidArgumentError,
+        CanceledError,
+        InternalError,
+    )
+}
+
+
+def error_for_code(code: int) -> type[SpiceDBValidationError]:
+    """Returns the exception class for a category code, as also returned by
+    validate_url."""
+    return _BY_CODE.get(code, InternalError)
+
+
+def raise_for_result(result: dict) -> dict:
+    """Raises the exception for the category of a failed result, and returns
+    successful results unchanged."""
+    status = result.get("status")
+    if status == "success":
+        return result
+
+    category = result.get("category") or {}
+    cls = error_for_code(category.get("code", InternalError.code))
+    if status == "failure" and result.get("errors"):
+        message = result["errors"][0]["message"]
+    else:
+        message = result.get("error") or f"validation {status}"
+    raise cls(message, result)
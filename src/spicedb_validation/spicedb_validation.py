@@ -1,3 +1,4 @@
+import json
 import os
 import sys
 
@@ -7,6 +8,342 @@ dll = ctypes.cdll.LoadLibrary(
     os.path.join(os.path.dirname(__file__), "dll", "spicedb_validation.so")
 )
 
+dll.validateURL.argtypes = [ctypes.c_char_p]
+dll.validateURL.restype = ctypes.c_int
+dll.validateURLJSON.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
+dll.validateURLJSON.restype = ctypes.c_void_p
+dll.validateContentsJSON.argtypes = [
+    ctypes.c_char_p,
+    ctypes.c_int,
+    ctypes.c_char_p,
+    ctypes.c_char_p,
+]
+dll.validateContentsJSON.restype = ctypes.c_void_p
+dll.validateBatchJSON.argtypes = [ctypes.c_char_p, ctypes.c_int, ctypes.c_char_p]
+dll.validateBatchJSON.restype = ctypes.c_void_p
+dll.loadDocumentURL.argtypes = [ctypes.c_char_p, ctypes.c_char_p]
+dll.loadDocumentURL.restype = ctypes.c_void_p
+dll.loadDocumentContents.argtypes = [
+    ctypes.c_char_p,
+    ctypes.c_int,
+    ctypes.c_char_p,
+    ctypes.c_char_p,
+]
+dll.loadDocumentContents.restype = ctypes.c_void_p
+dll.validateDocumentJSON.argtypes = [ctypes.c_ulonglong, ctypes.c_char_p]
+dll.validateDocumentJSON.restype = ctypes.c_void_p
+dll.checkPermission.argtypes = [
+    ctypes.c_ulonglong,
+    ctypes.c_char_p,
+    ctypes.c_char_p,
+    ctypes.c_char_p,
+    ctypes.c_char_p,
+    ctypes.c_char_p,
+]
+dll.checkPermission.restype = ctypes.c_void_p
+dll.expandPermission.argtypes = [
+    ctypes.c_ulonglong,
+    ctypes.c_char_p,
+    ctypes.c_char_p,
+    ctypes.c_int,
+    ctypes.c_char_p,
+]
+dll.expandPermission.restype = ctypes.c_void_p
+for _lookup in (dll.lookupResources, dll.lookupSubjects):
+    _lookup.argtypes = [
+        ctypes.c_ulonglong,
+        ctypes.c_char_p,
+        ctypes.c_char_p,
+        ctypes.c_char_p,
+        ctypes.c_char_p,
+        ctypes.c_char_p,
+    ]
+    _lookup.restype = ctypes.c_void_p
+dll.freeDocument.argtypes = [ctypes.c_ulonglong]
+dll.freeDocument.restype = ctypes.c_int
+dll.newCancelHandle.argtypes = []
+dll.newCancelHandle.restype = ctypes.c_ulonglong
+dll.cancelHandle.argtypes = [ctypes.c_ulonglong]
+dll.cancelHandle.restype = ctypes.c_int
+dll.freeCancelHandle.argtypes = [ctypes.c_ulonglong]
+dll.freeCancelHandle.restype = ctypes.c_int
+OUTPUT_CALLBACK = ctypes.CFUNCTYPE(None, ctypes.c_int, ctypes.c_char_p)
+dll.setOutputCallback.argtypes = [OUTPUT_CALLBACK]
+dll.resetOutputCallback.argtypes = []
+dll.freeString.argtypes = [ctypes.c_void_p]
 
-def validate_url(url: str):
-    dll.validateURL(url.encode("utf-8"))
+STREAM_STDOUT = 0
+STREAM_STDERR = 1
+STREAM_LOG = 2
+
+# Keeps the registered callback alive while the library may call it.
+_output_callback = None
+
+
+def _take_json(ptr) -> dict:
+    try:
+        return json.loads(ctypes.string_at(ptr).decode("utf-8"))
+    finally:
+        dll.freeString(ptr)
+
+
+def _options(
+    timeout: float | None,
+    cancel_handle: int | None,
+    fail_fast: bool = False,
+    keep_going: bool = False,
+    http: dict | None = None,
+) -> bytes:
+    options = {}
+    if timeout is not None:
+        options["timeoutMs"] = int(timeout * 1000)
+    if cancel_handle is not None:
+        options["cancelHandle"] = cancel_handle
+    if fail_fast:
+        options["failFast"] = True
+    if keep_going:
+        options["keepGoing"] = True
+    if http:
+        options["http"] = http
+    return json.dumps(options).encode("utf-8")
+
+
+def validate_url(url: str) -> bool:
+    """Validate the document at url, printing the result. A directory or glob
+    pattern validates each document it matches."""
+    return dll.validateURL(url.encode("utf-8")) == 0
+
+
+def validate_url_json(
+    url: str,
+    *,
+    timeout=None,
+    cancel_handle=None,
+    fail_fast=False,
+    keep_going=False,
+    http=None,
+) -> dict:
+    """Validate the document at url. For a directory or glob pattern, validate
+    each document it matches and return a batch result, as validate_batch_json
+    does."""
+    return _take_json(
+        dll.validateURLJSON(
+            url.encode("utf-8"),
+            _options(timeout, cancel_handle, fail_fast, keep_going, http),
+        )
+    )
+
+
+def validate_contents_json(
+    contents: str | bytes,
+    filename: str = "",
+    *,
+    timeout=None,
+    cancel_handle=None,
+    fail_fast=False,
+    keep_going=False,
+    http=None,
+) -> dict:
+    if isinstance(contents, str):
+        contents = contents.encode("utf-8")
+    return _take_json(
+        dll.validateContentsJSON(
+            contents,
+            len(contents),
+            filename.encode("utf-8"),
+            _options(timeout, cancel_handle, fail_fast, keep_going, http),
+        )
+    )
+
+
+def validate_batch_json(
+    urls: list[str],
+    *,
+    workers: int = 0,
+    timeout=None,
+    cancel_handle=None,
+    fail_fast=False,
+    keep_going=False,
+    http=None,
+) -> dict:
+    """Validate the documents at urls, where a directory or glob pattern
+    stands for the documents it matches."""
+    return _take_json(
+        dll.validateBatchJSON(
+            json.dumps(urls).encode("utf-8"),
+            workers,
+            _options(timeout, cancel_handle, fail_fast, keep_going, http),
+        )
+    )
+
+
+def load_document_url(
+    url: str,
+    *,
+    timeout=None,
+    cancel_handle=None,
+    fail_fast=False,
+    keep_going=False,
+    http=None,
+) -> dict:
+    """Load the document at url. For a directory or glob pattern, load each
+    document it matches and return a status, the expanded sources, and the
+    result of each, keyed by source, with a handle of its own to free."""
+    return _take_json(
+        dll.loadDocumentURL(
+            url.encode("utf-8"),
+            _options(timeout, cancel_handle, fail_fast, keep_going, http),
+        )
+    )
+
+
+def load_document_contents(
+    contents: str | bytes,
+    filename: str = "",
+    *,
+    timeout=None,
+    cancel_handle=None,
+    fail_fast=False,
+    keep_going=False,
+    http=None,
+) -> dict:
+    if isinstance(contents, str):
+        contents = contents.encode("utf-8")
+    return _take_json(
+        dll.loadDocumentContents(
+            contents,
+            len(contents),
+            filename.encode("utf-8"),
+            _options(timeout, cancel_handle, fail_fast, keep_going, http),
+        )
+    )
+
+
+def validate_document(handle: int, *, timeout=None, cancel_handle=None) -> dict:
+    return _take_json(
+        dll.validateDocumentJSON(handle, _options(timeout, cancel_handle))
+    )
+
+
+def check_permission(
+    handle: int,
+    resource: str,
+    permission: str,
+    subject: str,
+    caveat_context: dict | None = None,
+    *,
+    timeout=None,
+    cancel_handle=None,
+) -> dict:
+    context = json.dumps(caveat_context) if caveat_context else ""
+    return _take_json(
+        dll.checkPermission(
+            handle,
+            resource.encode("utf-8"),
+            permission.encode("utf-8"),
+            subject.encode("utf-8"),
+            context.encode("utf-8"),
+            _options(timeout, cancel_handle),
+        )
+    )
+
+
+def expand_permission(
+    handle: int,
+    resource: str,
+    permission: str,
+    depth: int = 0,
+    *,
+    timeout=None,
+    cancel_handle=None,
+) -> dict:
+    return _take_json(
+        dll.expandPermission(
+            handle,
+            resource.encode("utf-8"),
+            permission.encode("utf-8"),
+            depth,
+            _options(timeout, cancel_handle),
+        )
+    )
+
+
+def lookup_resources(
+    handle: int,
+    resource_type: str,
+    permission: str,
+    subject: str,
+    caveat_context: dict | None = None,
+    *,
+    timeout=None,
+    cancel_handle=None,
+) -> dict:
+    context = json.dumps(caveat_context) if caveat_context else ""
+    return _take_json(
+        dll.lookupResources(
+            handle,
+            resource_type.encode("utf-8"),
+            permission.encode("utf-8"),
+            subject.encode("utf-8"),
+            context.encode("utf-8"),
+            _options(timeout, cancel_handle),
+        )
+    )
+
+
+def lookup_subjects(
+    handle: int,
+    resource: str,
+    permission: str,
+    subject_type: str,
+    caveat_context: dict | None = None,
+    *,
+    timeout=None,
+    cancel_handle=None,
+) -> dict:
+    context = json.dumps(caveat_context) if caveat_context else ""
+    return _take_json(
+        dll.lookupSubjects(
+            handle,
+            resource.encode("utf-8"),
+            permission.encode("utf-8"),
+            subject_type.encode("utf-8"),
+            context.encode("utf-8"),
+            _options(timeout, cancel_handle),
+        )
+    )
+
+
+def free_document(handle: int) -> bool:
+    return dll.freeDocument(handle) == 0
+
+
+def new_cancel_handle() -> int:
+    return dll.newCancelHandle()
+
+
+def cancel(cancel_handle: int) -> bool:
+    return dll.cancelHandle(cancel_handle) == 0
+
+
+def free_cancel_handle(cancel_handle: int) -> bool:
+    return dll.freeCancelHandle(cancel_handle) == 0
+
+
+def set_output_callback(fn) -> None:
+    """Route every console and log line to fn(stream, line)."""
+    global _output_callback
+
+    def _callback(stream, line):
+        fn(stream, line.decode("utf-8", errors="replace"))
+
+    callback = OUTPUT_CALLBACK(_callback)
+    dll.setOutputCallback(callback)
+    _output_callback = callback
+
+
+def reset_output_callback() -> None:
+    global _output_callback
+
+    dll.resetOutputCallback()
+    _output_callback = None
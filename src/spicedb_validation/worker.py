@@ -0,0 +1,339 @@
+"""Runs validation in a worker subprocess instead of loading the shared
+library into the interpreter.
+
+The worker is the `spicedb-validation` executable (built with `go build -o
+spicedb-validation .`) speaking JSON-RPC over its stdin and stdout. It
+survives forking and keeps crashes out of the interpreter. Its functions
+return the same results as those of spicedb_validation.spicedb_validation.
+"""
+
+import itertools
+import json
+import os
+import subprocess
+import threading
+
+
+class WorkerError(Exception):
+    """Raised when the worker rejects a request or stops responding."""
+
+
+class _PendingCall:
+    """A request waiting for its response."""
+
+    def __init__(self):
+        self.done = threading.Event()
+        self.response: dict | None = None
+
+
+class Worker:
+    """A worker subprocess. Its methods may be called from several threads at
+    once: requests run concurrently in the worker, and a reader thread hands
+    each response to the call waiting for it.
+
+    Every method takes an optional `request_id`, from `new_request_id`, which
+    another thread can pass to `cancel` to abort the request.
+    """
+
+    def __init__(self, executable: str | None = None):
+        if executable is None:
+            executable = os.environ.get(
+                "SPICEDB_VALIDATION_WORKER", "spicedb-validation"
+            )
+        self._process = subprocess.Popen(
+            [executable, "worker"],
+            stdin=subprocess.PIPE,
+            stdout=subprocess.PIPE,
+            encoding="utf-8",
+            bufsize=1,
+        )
+        self._ids = itertools.count(1)
+        # Guards writing requests and the calls waiting for a response.
+        self._lock = threading.Lock()
+        self._pending: dict[object, _PendingCall] = {}
+        self._exited = False
+        self._reader = threading.Thread(target=self._read_responses, daemon=True)
+        self._reader.start()
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc_info):
+        self.close()
+
+    def close(self) -> None:
+        if self._process.poll() is None:
+            self._process.stdin.close()
+            self._process.wait()
+        self._reader.join()
+
+    def new_request_id(self) -> int:
+        """Return an id for a request, to pass as its `request_id`."""
+        with self._lock:
+            return next(self._ids)
+
+    def cancel(self, request_id) -> bool:
+        """Abort the request with the given id, which then returns a
+        `canceled` result. Return False if it is not running."""
+        return self._call("cancel", id=request_id)["canceled"]
+
+    def _read_responses(self) -> None:
+        for line in self._process.stdout:
+            response = json.loads(line)
+            with self._lock:
+                pending = self._pending.pop(response.get("id"), None)
+            if pending is not None:
+                pending.response = response
+                pending.done.set()
+
+        with self._lock:
+            self._exited = True
+            pending_calls = list(self._pending.values())
+            self._pending.clear()
+        for pending in pending_calls:
+            pending.done.set()
+
+    def _call(self, method: str, request_id=None, **params) -> dict:
+        params = {k: v for k, v in params.items() if v is not None}
+        pending = _PendingCall()
+        with self._lock:
+            if request_id is None:
+                request_id = next(self._ids)
+            if self._exited:
+                raise WorkerError("worker exited")
+            if request_id in self._pending:
+                raise WorkerError(f"request {request_id!r} is already running")
+            self._pending[request_id] = pending
+            request = {
+                "jsonrpc": "2.0",
+                "id": request_id,
+                "method": method,
+                "params": params,
+            }
+            try:
+                self._process.stdin.write(json.dumps(request) + "\n")
+                self._process.stdin.flush()
+            except (BrokenPipeError, ValueError) as e:
+                del self._pending[request_id]
+                raise WorkerError("worker exited") from e
+
+        pending.done.wait()
+        response = pending.response
+        if response is None:
+            raise WorkerError("worker exited")
+        if "error" in response:
+            raise WorkerError(response["error"]["message"])
+        return response["result"]
+
+    @staticmethod
+    def _options(timeout, fail_fast=None, keep_going=None, http=None) -> dict:
+        return {
+            "timeoutMs": int(timeout * 1000) if timeout is not None else None,
+            "failFast": fail_fast or None,
+            "keepGoing": keep_going or None,
+            "http": http or None,
+        }
+
+    def validate_url_json(
+        self,
+        url: str,
+        *,
+        timeout=None,
+        fail_fast=False,
+        keep_going=False,
+        http=None,
+        request_id=None,
+    ) -> dict:
+        """Validate the document at url. For a directory or glob pattern,
+        validate each document it matches and return a batch result, as
+        validate_batch_json does."""
+        return self._call(
+            "validate",
+            request_id=request_id,
+            source=url,
+            **self._options(timeout, fail_fast, keep_going, http),
+        )
+
+    def validate_contents_json(
+        self,
+        contents: str | bytes,
+        filename: str = "",
+        *,
+        timeout=None,
+        fail_fast=False,
+        keep_going=False,
+        http=None,
+        request_id=None,
+    ) -> dict:
+        if isinstance(contents, bytes):
+            contents = contents.decode("utf-8")
+        return self._call(
+            "validate",
+            request_id=request_id,
+            source=filename,
+            contents=contents,
+            **self._options(timeout, fail_fast, keep_going, http),
+        )
+
+    def validate_batch_json(
+        self,
+        urls: list[str],
+        *,
+        workers: int = 0,
+        timeout=None,
+        fail_fast=False,
+        keep_going=False,
+        http=None,
+        request_id=None,
+    ) -> dict:
+        """Validate the documents at urls, where a directory or glob pattern
+        stands for the documents it matches."""
+        return self._call(
+            "validateBatch",
+            request_id=request_id,
+            sources=urls,
+            workers=workers,
+            **self._options(timeout, fail_fast, keep_going, http),
+        )
+
+    def load_document_url(
+        self,
+        url: str,
+        *,
+        timeout=None,
+        fail_fast=False,
+        keep_going=False,
+        http=None,
+        request_id=None,
+    ) -> dict:
+        """Load the document at url. For a directory or glob pattern, load
+        each document it matches and return a status, the expanded sources,
+        and the result of each, keyed by source, with a handle of its own to
+        free."""
+        return self._call(
+            "load",
+            request_id=request_id,
+            source=url,
+            **self._options(timeout, fail_fast, keep_going, http),
+        )
+
+    def load_document_contents(
+        self,
+        contents: str | bytes,
+        filename: str = "",
+        *,
+        timeout=None,
+        fail_fast=False,
+        keep_going=False,
+        http=None,
+        request_id=None,
+    ) -> dict:
+        if isinstance(contents, bytes):
+            contents = contents.decode("utf-8")
+        return self._call(
+            "load",
+            request_id=request_id,
+            source=filename,
+            contents=contents,
+            **self._options(timeout, fail_fast, keep_going, http),
+        )
+
+    def validate_document(
+        self, handle: int, *, timeout=None, request_id=None
+    ) -> dict:
+        return self._call(
+            "validateDocument",
+            request_id=request_id,
+            handle=handle,
+            **self._options(timeout),
+        )
+
+    def check_permission(
+        self,
+        handle: int,
+        resource: str,
+        permission: str,
+        subject: str,
+        caveat_context: dict | None = None,
+        *,
+        timeout=None,
+        request_id=None,
+    ) -> dict:
+        return self._call(
+            "check",
+            request_id=request_id,
+            handle=handle,
+            resource=resource,
+            permission=permission,
+            subject=subject,
+            caveatContext=caveat_context,
+            **self._options(timeout),
+        )
+
+    def expand_permission(
+        self,
+        handle: int,
+        resource: str,
+        permission: str,
+        depth: int = 0,
+        *,
+        timeout=None,
+        request_id=None,
+    ) -> dict:
+        return self._call(
+            "expand",
+            request_id=request_id,
+            handle=handle,
+            resource=resource,
+            permission=permission,
+            depth=depth,
+            **self._options(timeout),
+        )
+
+    def lookup_resources(
+        self,
+        handle: int,
+        resource_type: str,
+        permission: str,
+        subject: str,
+        caveat_context: dict | None = None,
+        *,
+        timeout=None,
+        request_id=None,
+    ) -> dict:
+        return self._call(
+            "lookupResources",
+            request_id=request_id,
+            handle=handle,
+            resourceType=resource_type,
+            permission=permission,
+            subject=subject,
+            caveatContext=caveat_context,
+            **self._options(timeout),
+        )
+
+    def lookup_subjects(
+        self,
+        handle: int,
+        resource: str,
+        permission: str,
+        subject_type: str,
+        caveat_context: dict | None = None,
+        *,
+        timeout=None,
+        request_id=None,
+    ) -> dict:
+        return self._call(
+            "lookupSubjects",
+            request_id=request_id,
+            handle=handle,
+            resource=resource,
+            permission=permission,
+            subjectType=subject_type,
+            caveatContext=caveat_context,
+            **self._options(timeout),
+        )
+
+    def free_document(self, handle: int, *, request_id=None) -> bool:
+        result = self._call("free", request_id=request_id, handle=handle)
+        return result["status"] == "success"
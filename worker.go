@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/leetrout/python-spicedb-validation/pkg/validate"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+// nullID is the id of responses to requests whose id could not be read.
+var nullID = json.RawMessage("null")
+
+// maxRequestSize bounds a single request line, which may carry a whole
+// document.
+const maxRequestSize = 64 << 20
+
+// rpcRequest is a JSON-RPC 2.0 request. Requests are read one per line.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response, written one per line.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// documentParams name a document by source, or carry it inline as contents
+// with the source naming it.
+type documentParams struct {
+	callOptions
+	Source   string  `json:"source"`
+	Contents *string `json:"contents,omitempty"`
+}
+
+func (p documentParams) validateOptions() validate.Options {
+	opts := validate.Options{Source: p.Source}
+	if p.Contents != nil {
+		opts.Contents = []byte(*p.Contents)
+	}
+	return p.callOptions.validateOptions(opts)
+}
+
+type batchParams struct {
+	callOptions
+	Sources []string `json:"sources"`
+	Workers int      `json:"workers"`
+}
+
+type handleParams struct {
+	callOptions
+	Handle uint64 `json:"handle"`
+}
+
+type checkParams struct {
+	handleParams
+	Resource      string          `json:"resource"`
+	Permission    string          `json:"permission"`
+	Subject       string          `json:"subject"`
+	CaveatContext json.RawMessage `json:"caveatContext,omitempty"`
+}
+
+type expandParams struct {
+	handleParams
+	Resource   string `json:"resource"`
+	Permission string `json:"permission"`
+	Depth      int    `json:"depth"`
+}
+
+type lookupResourcesParams struct {
+	handleParams
+	ResourceType  string          `json:"resourceType"`
+	Permission    string          `json:"permission"`
+	Subject       string          `json:"subject"`
+	CaveatContext json.RawMessage `json:"caveatContext,omitempty"`
+}
+
+type lookupSubjectsParams struct {
+	handleParams
+	Resource      string          `json:"resource"`
+	Permission    string          `json:"permission"`
+	SubjectType   string          `json:"subjectType"`
+	CaveatContext json.RawMessage `json:"caveatContext,omitempty"`
+}
+
+type cancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// rpcMethod runs a request. It returns the options to run under, and a
+// function producing the result under the context built from them.
+type rpcMethod func(params json.RawMessage) (callOptions, func(ctx context.Context) any, error)
+
+// rpcParams are the params of a method, which all embed callOptions.
+type rpcParams interface {
+	options() callOptions
+}
+
+// method adapts a function taking typed params into an rpcMethod.
+func method[P rpcParams](fn func(ctx context.Context, params P) any) rpcMethod {
+	return func(raw json.RawMessage) (callOptions, func(ctx context.Context) any, error) {
+		var params P
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return callOptions{}, nil, err
+			}
+		}
+		return params.options(), func(ctx context.Context) any { return fn(ctx, params) }, nil
+	}
+}
+
+// rpcMethods are the methods served by the worker. They return the same
+// results as the exported functions of the shared library.
+var rpcMethods = map[string]rpcMethod{
+	"validate": method(func(ctx context.Context, p documentParams) any {
+		return validateSource(ctx, p.validateOptions())
+	}),
+	"validateBatch": method(func(ctx context.Context, p batchParams) any {
+		return validateBatch(ctx, p.callOptions, p.Sources, p.Workers)
+	}),
+	"load": method(func(ctx context.Context, p documentParams) any {
+		return loadSource(ctx, p.validateOptions())
+	}),
+	"validateDocument": method(func(ctx context.Context, p handleParams) any {
+		return validateDocumentHandle(ctx, p.Handle)
+	}),
+	"check": method(func(ctx context.Context, p checkParams) any {
+		return checkDocumentHandle(ctx, p.Handle, p.Resource, p.Permission, p.Subject, string(p.CaveatContext))
+	}),
+	"expand": method(func(ctx context.Context, p expandParams) any {
+		return expandDocumentHandle(ctx, p.Handle, p.Resource, p.Permission, p.Depth)
+	}),
+	"lookupResources": method(func(ctx context.Context, p lookupResourcesParams) any {
+		return lookupResourcesDocumentHandle(ctx, p.Handle, p.ResourceType, p.Permission, p.Subject, string(p.CaveatContext))
+	}),
+	"lookupSubjects": method(func(ctx context.Context, p lookupSubjectsParams) any {
+		return lookupSubjectsDocumentHandle(ctx, p.Handle, p.Resource, p.Permission, p.SubjectType, string(p.CaveatContext))
+	}),
+	"free": method(func(_ context.Context, p handleParams) any {
+		if err := freeDocumentHandle(p.Handle); err != nil {
+			return newErrorResult(err)
+		}
+		return map[string]validate.Status{"status": validate.StatusSuccess}
+	}),
+}
+
+// worker serves JSON-RPC requests read from in, one per line, writing the
+// responses to out. Requests run concurrently, so responses may arrive out
+// of order; a running request can be aborted with the "cancel" method.
+type worker struct {
+	in  io.Reader
+	out io.Writer
+
+	outMu sync.Mutex
+
+	mu       sync.Mutex
+	inFlight map[string]context.CancelFunc
+}
+
+func newWorker(in io.Reader, out io.Writer) *worker {
+	return &worker{in: in, out: out, inFlight: map[string]context.CancelFunc{}}
+}
+
+// serve handles requests until in is exhausted, then waits for the running
+// requests to finish.
+func (w *worker) serve() error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	scanner := bufio.NewScanner(w.in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRequestSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			w.replyError(nullID, rpcParseError, err.Error())
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			id := req.ID
+			if id == nil {
+				id = nullID
+			}
+			w.replyError(id, rpcInvalidRequest, "invalid JSON-RPC 2.0 request")
+			continue
+		}
+
+		if req.Method == "cancel" {
+			w.cancel(req)
+			continue
+		}
+
+		run := w.start(req)
+		if run == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run()
+		}()
+	}
+	return scanner.Err()
+}
+
+// start prepares the request and returns a function running it, or nil if
+// the request was answered already. The request is in flight from the
+// moment start returns, so a cancel read right after it finds it.
+func (w *worker) start(req rpcRequest) func() {
+	m, ok := rpcMethods[req.Method]
+	if !ok {
+		w.replyError(req.ID, rpcMethodNotFound, fmt.Sprintf("unknown method %q", req.Method))
+		return nil
+	}
+
+	opts, run, err := m(req.Params)
+	if err != nil {
+		w.replyError(req.ID, rpcInvalidParams, fmt.Sprintf("invalid params: %s", err))
+		return nil
+	}
+
+	ctx, cancel, err := opts.context()
+	if err != nil {
+		w.reply(req.ID, newErrorResult(err))
+		return nil
+	}
+
+	key := string(req.ID)
+	if req.ID != nil {
+		w.mu.Lock()
+		w.inFlight[key] = cancel
+		w.mu.Unlock()
+	}
+
+	return func() {
+		defer cancel()
+		if req.ID != nil {
+			defer func() {
+				w.mu.Lock()
+				delete(w.inFlight, key)
+				w.mu.Unlock()
+			}()
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				w.replyError(req.ID, rpcInternalError, newPanicResult(r).Error)
+			}
+		}()
+
+		w.reply(req.ID, run(ctx))
+	}
+}
+
+// cancel aborts the running request with the given id. Requests that have
+// already finished are ignored.
+func (w *worker) cancel(req rpcRequest) {
+	var params cancelParams
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.ID == nil {
+		w.replyError(req.ID, rpcInvalidParams, "cancel requires the id of a request")
+		return
+	}
+
+	w.mu.Lock()
+	cancel, ok := w.inFlight[string(params.ID)]
+	w.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	w.reply(req.ID, map[string]bool{"canceled": ok})
+}
+
+func (w *worker) reply(id json.RawMessage, result any) {
+	if id == nil {
+		return // a notification
+	}
+	w.write(rpcResponse{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (w *worker) replyError(id json.RawMessage, code int, message string) {
+	if id == nil {
+		return // a notification
+	}
+	w.write(rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}})
+}
+
+func (w *worker) write(resp rpcResponse) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(rpcResponse{JSONRPC: "2.0", ID: resp.ID, Error: &rpcError{Code: rpcInternalError, Message: err.Error()}})
+	}
+
+	w.outMu.Lock()
+	defer w.outMu.Unlock()
+	_, _ = w.out.Write(append(data, '\n'))
+}
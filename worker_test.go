@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// serveRequests runs a worker over the given request lines and returns the
+// responses keyed by id.
+func serveRequests(t *testing.T, requests ...string) map[string]rpcResponse {
+	t.Helper()
+	var out bytes.Buffer
+	require.NoError(t, newWorker(strings.NewReader(strings.Join(requests, "\n")), &out).serve())
+
+	responses := map[string]rpcResponse{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var resp rpcResponse
+		require.NoError(t, json.Unmarshal([]byte(line), &resp), line)
+		responses[string(resp.ID)] = resp
+	}
+	return responses
+}
+
+func resultMap(t *testing.T, resp rpcResponse) map[string]any {
+	t.Helper()
+	require.Nil(t, resp.Error)
+	data, err := json.Marshal(resp.Result)
+	require.NoError(t, err)
+	var result map[string]any
+	require.NoError(t, json.Unmarshal(data, &result))
+	return result
+}
+
+func TestWorker(t *testing.T) {
+	contents, err := json.Marshal(testCaveatedDocument)
+	require.NoError(t, err)
+
+	load := serveRequests(t, `{"jsonrpc":"2.0","id":1,"method":"load","params":{"source":"test.yaml","contents":`+string(contents)+`}}`)
+	loaded := resultMap(t, load["1"])
+	require.Equal(t, "success", loaded["status"])
+	handle := uint64(loaded["handle"].(float64))
+	t.Cleanup(func() { _ = freeDocumentHandle(handle) })
+
+	handleJSON, err := json.Marshal(handle)
+	require.NoError(t, err)
+	h := string(handleJSON)
+
+	responses := serveRequests(t,
+		`{"jsonrpc":"2.0","id":2,"method":"check","params":{"handle":`+h+`,"resource":"document:plan","permission":"view","subject":"user:bob","caveatContext":{"network":"office"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"lookupSubjects","params":{"handle":`+h+`,"resource":"document:plan","permission":"view","subjectType":"user"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"expand","params":{"handle":`+h+`,"resource":"document:plan","permission":"view"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"validateDocument","params":{"handle":`+h+`,"timeoutMs":10000}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"validate","params":{"source":"bad.yaml","contents":"schema: |-\n  definition user {\n"}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"check","params":{"handle":0,"resource":"document:plan","permission":"view","subject":"user:bob"}}`,
+		`{"jsonrpc":"2.0","id":8,"method":"validateBatch","params":{"sources":["missing-1.yaml","missing-2.yaml"],"workers":2}}`,
+	)
+	require.Len(t, responses, 7)
+	require.Equal(t, "has_permission", resultMap(t, responses["2"])["permissionship"])
+	require.Len(t, resultMap(t, responses["3"])["results"], 2)
+	require.Contains(t, resultMap(t, responses["4"])["treeText"], "user:alice")
+	require.Equal(t, "success", resultMap(t, responses["5"])["status"])
+	require.Equal(t, "failure", resultMap(t, responses["6"])["status"])
+	require.Equal(t, "error", resultMap(t, responses["7"])["status"])
+	batch := resultMap(t, responses["8"])
+	require.Equal(t, "error", batch["status"])
+	require.Len(t, batch["results"], 2)
+	require.Equal(t, float64(2), batch["summary"].(map[string]any)["errored"])
+
+	free := serveRequests(t, `{"jsonrpc":"2.0","id":9,"method":"free","params":{"handle":`+h+`}}`)
+	require.Equal(t, "success", resultMap(t, free["9"])["status"])
+}
+
+func TestWorkerProtocolErrors(t *testing.T) {
+	responses := serveRequests(t,
+		`not json`,
+		`{"id":1,"method":"validate"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"unknown"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"check","params":{"handle":"one"}}`,
+		`{"jsonrpc":"2.0","method":"unknown"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"cancel","params":{"id":99}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"cancel"}`,
+	)
+	require.Len(t, responses, 6)
+	require.Equal(t, rpcParseError, responses["null"].Error.Code)
+	require.Equal(t, rpcInvalidRequest, responses["1"].Error.Code)
+	require.Equal(t, rpcMethodNotFound, responses["2"].Error.Code)
+	require.Equal(t, rpcInvalidParams, responses["3"].Error.Code)
+	require.Equal(t, false, resultMap(t, responses["4"])["canceled"])
+	require.Equal(t, rpcInvalidParams, responses["5"].Error.Code)
+}
+
+func TestWorkerCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	// The cancel is read right after the request it cancels, while that is
+	// still waiting on the server.
+	responses := serveRequests(t,
+		`{"jsonrpc":"2.0","id":1,"method":"validate","params":{"source":"`+server.URL+`/document.yaml","timeoutMs":10000}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"cancel","params":{"id":1}}`,
+	)
+	require.Len(t, responses, 2)
+	require.Equal(t, true, resultMap(t, responses["2"])["canceled"])
+	canceled := resultMap(t, responses["1"])
+	require.Equal(t, "error", canceled["status"])
+	require.Equal(t, "canceled", canceled["category"].(map[string]any)["name"])
+}